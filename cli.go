@@ -0,0 +1,83 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package main
+
+import (
+	"flag"
+
+	"sten/config"
+)
+
+// options are the flags that pick a config and override parts of it.
+type options struct {
+	config       string
+	dictionaries string
+	port         string
+	machine      string
+	// validate checks the config in place of Config.Validate, given the
+	// problems Read found, for commands that use only part of it.
+	validate func(cfg *config.Config, read []config.Problem) []config.Problem
+}
+
+// register adds --config and --dictionaries to fs, and --port and --machine
+// too when machine is set.
+func (o *options) register(fs *flag.FlagSet, machine bool) {
+	fs.StringVar(&o.config, "config", "", "config file (default $XDG_CONFIG_HOME/sten/config.json)")
+	fs.StringVar(&o.dictionaries, "dictionaries", "", "dictionary folder, overriding the config (default $XDG_DATA_HOME/sten/dictionaries)")
+	if machine {
+		fs.StringVar(&o.port, "port", "", "serial port, overriding the config")
+		fs.StringVar(&o.machine, "machine", "", "machine type, overriding the config")
+	}
+}
+
+// load reads the config, applies the overrides and then validates it. On first run, the default
+// config and the bundled dictionaries are put in their XDG folders; a config
+// or folder named on the command line or in the config is used as it is.
+func (o *options) load() (*config.Config, error) {
+	path := o.config
+	if path == "" {
+		var err error
+		if path, err = config.DefaultPath(); err != nil {
+			return nil, err
+		}
+		if err := ensureConfig(path); err != nil {
+			return nil, err
+		}
+	}
+	cfg, problems, err := config.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Resolve(path); err != nil {
+		return nil, err
+	}
+
+	if o.dictionaries != "" {
+		cfg.Dictionaries = o.dictionaries
+	}
+	if cfg.Dictionaries == "" {
+		if cfg.Dictionaries, err = config.DefaultDictionaries(); err != nil {
+			return nil, err
+		}
+		if err := ensureDictionaries(cfg.Dictionaries); err != nil {
+			return nil, err
+		}
+	}
+	if o.port != "" {
+		cfg.Port = o.port
+	}
+	if o.machine != "" {
+		cfg.Machine = o.machine
+	}
+	if o.validate != nil {
+		problems = o.validate(cfg, problems)
+	} else {
+		problems = append(problems, cfg.Validate()...)
+	}
+	if err := config.Check(problems); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
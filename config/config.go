@@ -4,47 +4,38 @@
 
 package config
 
-import (
-	"encoding/json"
-	"fmt"
-	"os"
-	"sten/machine"
-)
-
 type Config struct {
-	Port        string            `json:"serial_port"`
-	Baud        int               `json:"baud_rate"`
-	ReadTimeout int               `json:"timeout"`
-	Machine     string            `json:"machine"`
-	CustomKeys  map[string]string `json:"custom_keys"`
-	Dev         bool              `json:"dev"`
-}
-
-func (cfg *Config) setCustomKeys() map[string]string {
-	switch cfg.Machine {
-	case "geminipr":
-		for k, v := range cfg.CustomKeys {
-			machine.GeminiDefaults[k] = v
-		}
-		return machine.GeminiDefaults
-	// case "other":
-	//     return SomeOtherLayout
-	default:
-		panic("Unknown machine type: " + cfg.Machine)
-	}
+	Port         string            `json:"serial_port"`
+	Baud         int               `json:"baud_rate"`
+	ReadTimeout  int               `json:"timeout,omitempty"`
+	Machine      string            `json:"machine"`
+	CustomKeys   map[string]string `json:"custom_keys,omitempty"`
+	Dev          bool              `json:"dev"`
+	UndoDepth    int               `json:"undo_depth"`
+	UndoMode     string            `json:"undo_mode"`
+	Untranslate  string            `json:"untranslate"`
+	Marker       string            `json:"untranslate_marker,omitempty"`
+	Snapshot     string            `json:"snapshot,omitempty"`
+	Space        string            `json:"space"`
+	LogPath      string            `json:"log_path,omitempty"`
+	LogMaxSize   int64             `json:"log_max_size,omitempty"`
+	LogKeep      int               `json:"log_keep,omitempty"`
+	ReplayFile   string            `json:"replay_file,omitempty"`
+	ReplaySpeed  float64           `json:"replay_speed,omitempty"`
+	Dictionaries string            `json:"dictionaries,omitempty"`
+	KeyBindings  map[string]string `json:"key_bindings,omitempty"`
+	Layers       map[string]string `json:"layers,omitempty"`
 }
 
+// Load reads and validates the config at path, logging any warnings. All
+// of its problems are reported together in a *ValidationError.
 func Load(path string) (*Config, error) {
-	f, err := os.Open(path)
+	cfg, problems, err := Read(path)
 	if err != nil {
-		return nil, fmt.Errorf("could not open config file: %w", err)
+		return nil, err
 	}
-	defer f.Close()
-
-	var cfg Config
-	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
-		return nil, fmt.Errorf("could not decode config: %w", err)
+	if err := Check(append(problems, cfg.Validate()...)); err != nil {
+		return nil, err
 	}
-	cfg.setCustomKeys()
-	return &cfg, nil
+	return cfg, nil
 }
@@ -6,6 +6,8 @@ package config
 
 import (
 	"os"
+	"sten/machine"
+	"strings"
 	"testing"
 )
 
@@ -30,3 +32,168 @@ func TestLoadConfig(t *testing.T) {
 		t.Errorf("config port failed to parse")
 	}
 }
+
+func TestPaths(t *testing.T) {
+	t.Setenv("HOME", "/home/writer")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_DATA_HOME", "relative/data") // ignored, as the spec asks
+	t.Setenv("XDG_STATE_HOME", "")
+
+	cases := []struct {
+		name     string
+		fn       func() (string, error)
+		expected string
+	}{
+		{"Config", DefaultPath, "/xdg/config/sten/config.json"},
+		{"Dictionaries", DefaultDictionaries, "/home/writer/.local/share/sten/dictionaries"},
+		{"State", StateDir, "/home/writer/.local/state/sten"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.fn()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("want %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     string
+		problems []string
+	}{
+		{
+			name: "Valid",
+			data: `{"machine": "geminipr", "serial_port": "config_test.go", "baud_rate": 9600, "timeout": 100}`,
+		},
+		{
+			name:     "Unknown Key",
+			data:     `{"machine": "geminipr", "serial_port": "config_test.go", "time_out": 100}`,
+			problems: []string{`$.time_out: warning: unknown key, did you mean "timeout"?`},
+		},
+		{
+			name:     "Wrong Type",
+			data:     `{"machine": "geminipr", "serial_port": "config_test.go", "baud_rate": "fast"}`,
+			problems: []string{"$.baud_rate: expected int, got string"},
+		},
+		{
+			name: "Every Problem At Once",
+			data: `{"machine": "geminipr", "undo_depth": -1, "space": "around", "custom_keys": {"Q": "S-"}}`,
+			problems: []string{
+				"$.custom_keys.Q: is not a key on this machine",
+				`$.serial_port: is required for machine "geminipr"`,
+				`$.space: must be one of after, before, got "around"`,
+				"$.undo_depth: must not be negative, got -1",
+			},
+		},
+		{
+			name: "Bad Custom Keys",
+			data: `{"machine": "geminipr", "serial_port": "config_test.go", "custom_keys": {"S1-": "#-", "S2-": "Q-", "res9": "S-"}}`,
+			problems: []string{
+				`$.custom_keys.S2-: maps to "Q-", which is not a steno key`,
+				"$.custom_keys.res9: is not a key on this machine",
+			},
+		},
+		{
+			name:     "Custom Keys Without A Layout",
+			data:     `{"machine": "replay", "replay_file": "config_test.go", "custom_keys": {"S1-": "S-"}}`,
+			problems: []string{`$.custom_keys.S1-: cannot be set: machine "replay" has no key layout`},
+		},
+		{
+			name:     "Unknown Machine",
+			data:     `{"machine": "qwerty"}`,
+			problems: []string{`$.machine: unknown machine type "qwerty" (available: geminipr, replay)`},
+		},
+		{
+			name:     "Missing Replay File",
+			data:     `{"machine": "replay", "replay_file": "missing.txt"}`,
+			problems: []string{"$.replay_file: warning: missing.txt does not exist yet"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := t.TempDir() + "/config.json"
+			if err := os.WriteFile(path, []byte(tc.data), 0644); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+			cfg, problems, err := Read(path)
+			if err != nil {
+				t.Fatalf("failed to read config: %v", err)
+			}
+			var got []string
+			for _, p := range append(problems, cfg.Validate()...) {
+				got = append(got, p.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.problems, "\n") {
+				t.Errorf("want problems:\n%s\ngot:\n%s", strings.Join(tc.problems, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestValidateTranslate(t *testing.T) {
+	gemini, err := machine.Lookup("geminipr")
+	if err != nil {
+		t.Fatalf("failed to look up geminipr: %v", err)
+	}
+	replay, err := machine.Lookup("replay")
+	if err != nil {
+		t.Fatalf("failed to look up replay: %v", err)
+	}
+	cases := []struct {
+		name     string
+		data     string
+		driver   machine.Driver
+		problems []string
+	}{
+		{
+			name:   "Machine Not Set Up",
+			data:   `{"machine": "geminipr", "baud_rate": "fast", "timeout": -1, "time_out": 100}`,
+			driver: gemini,
+			problems: []string{
+				`$.time_out: warning: unknown key, did you mean "timeout"?`,
+			},
+		},
+		{
+			name:   "Translator Settings",
+			data:   `{"machine": "qwerty", "undo_depth": -1, "space": "around", "custom_keys": {"Q": "S-"}}`,
+			driver: gemini,
+			problems: []string{
+				"$.custom_keys.Q: is not a key on this machine",
+				`$.space: must be one of after, before, got "around"`,
+				"$.undo_depth: must not be negative, got -1",
+			},
+		},
+		{
+			name:   "Steno Ignores Custom Keys",
+			data:   `{"machine": "geminipr", "custom_keys": {"Q": "S-"}}`,
+			driver: replay,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := t.TempDir() + "/config.json"
+			if err := os.WriteFile(path, []byte(tc.data), 0644); err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+			cfg, problems, err := Read(path)
+			if err != nil {
+				t.Fatalf("failed to read config: %v", err)
+			}
+			var got []string
+			for _, p := range cfg.ValidateTranslate(tc.driver, problems) {
+				got = append(got, p.String())
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.problems, "\n") {
+				t.Errorf("want problems:\n%s\ngot:\n%s", strings.Join(tc.problems, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Locations follow the XDG base directory spec: config in
+// $XDG_CONFIG_HOME/sten, dictionaries in $XDG_DATA_HOME/sten and logs and
+// snapshots in $XDG_STATE_HOME/sten, each falling back to the usual folder
+// under $HOME when the variable is unset.
+
+// ConfigDir returns the folder the config file lives in.
+func ConfigDir() (string, error) {
+	return xdg("XDG_CONFIG_HOME", ".config")
+}
+
+// DataDir returns the folder dictionaries live in.
+func DataDir() (string, error) {
+	return xdg("XDG_DATA_HOME", ".local/share")
+}
+
+// StateDir returns the folder stroke logs and snapshots go in.
+func StateDir() (string, error) {
+	return xdg("XDG_STATE_HOME", ".local/state")
+}
+
+// DefaultPath returns where the config file is read from when no other
+// file is named.
+func DefaultPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// DefaultDictionaries returns where dictionaries are read from when the
+// config does not name a folder.
+func DefaultDictionaries() (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dictionaries"), nil
+}
+
+// xdg returns $env/sten, or $HOME/fallback/sten if env is unset. Relative
+// values are ignored, as the spec asks.
+func xdg(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "sten"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.New("neither $" + env + " nor $HOME is set")
+	}
+	return filepath.Join(home, fallback, "sten"), nil
+}
+
+// Default returns the config written on first run.
+func Default() *Config {
+	return &Config{
+		Port:        "/dev/ttyACM0",
+		Baud:        9600,
+		Machine:     "geminipr",
+		Dev:         true,
+		UndoDepth:   100,
+		UndoMode:    "stroke",
+		Untranslate: "raw",
+		Space:       "after",
+	}
+}
+
+// Save writes cfg to path as indented JSON, creating its folder.
+func (cfg *Config) Save(path string) error {
+	data, err := json.MarshalIndent(cfg, "", "    ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Resolve makes the paths in cfg absolute. Dictionaries and layers are found
+// next to the config file at path, and stroke logs and snapshots in StateDir.
+func (cfg *Config) Resolve(path string) error {
+	if cfg.Dictionaries != "" && !filepath.IsAbs(cfg.Dictionaries) {
+		cfg.Dictionaries = filepath.Join(filepath.Dir(path), cfg.Dictionaries)
+	}
+	for keys, folder := range cfg.Layers {
+		if folder != "" && !filepath.IsAbs(folder) {
+			cfg.Layers[keys] = filepath.Join(filepath.Dir(path), folder)
+		}
+	}
+	for _, p := range []*string{&cfg.LogPath, &cfg.Snapshot} {
+		if *p == "" || filepath.IsAbs(*p) {
+			continue
+		}
+		dir, err := StateDir()
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		*p = filepath.Join(dir, *p)
+	}
+	return nil
+}
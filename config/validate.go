@@ -0,0 +1,279 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"sten/machine"
+	"strings"
+)
+
+// Problem is something wrong with one value in a config file, at a JSON
+// path such as "$.custom_keys.S1-". Warnings do not stop sten from running.
+type Problem struct {
+	Path    string
+	Message string
+	Warning bool
+}
+
+func (p Problem) String() string {
+	if p.Warning {
+		return fmt.Sprintf("%s: warning: %s", p.Path, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.Path, p.Message)
+}
+
+// ValidationError lists every problem that stops a config from being used.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return "invalid config:\n  " + strings.Join(lines, "\n  ")
+}
+
+// Baud rates serial stenotypes use. Others work but are likely typos.
+var standardBauds = []int{1200, 2400, 4800, 9600, 19200, 38400, 57600, 115200}
+
+// Read decodes the config file at path one key at a time, so that a bad
+// value does not hide the ones after it. Unknown keys and values of the
+// wrong type come back as problems; only failing to read the file is an
+// error.
+func Read(path string) (*Config, []Problem, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open config file: %w", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("could not decode config: %w", err)
+	}
+
+	var cfg Config
+	fields := jsonFields(&cfg)
+	var problems []Problem
+	for _, key := range sortedKeys(raw) {
+		field, ok := fields[key]
+		if !ok {
+			problems = append(problems, Problem{Path: "$." + key, Message: unknownKey(key, fields), Warning: true})
+			continue
+		}
+		if err := json.Unmarshal(raw[key], field.Addr().Interface()); err != nil {
+			problems = append(problems, typeProblem(key, err))
+		}
+	}
+	return &cfg, problems, nil
+}
+
+// Validate checks that the values make sense together: ranges, the machine
+// name, the settings the machine needs and its custom keys.
+func (cfg *Config) Validate() []Problem {
+	fields := jsonFields(cfg)
+	var problems []Problem
+	fail := func(path, format string, args ...any) {
+		problems = append(problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	warn := func(path, format string, args ...any) {
+		problems = append(problems, Problem{Path: path, Message: fmt.Sprintf(format, args...), Warning: true})
+	}
+
+	for key, n := range map[string]float64{
+		"timeout":      float64(cfg.ReadTimeout),
+		"undo_depth":   float64(cfg.UndoDepth),
+		"log_max_size": float64(cfg.LogMaxSize),
+		"log_keep":     float64(cfg.LogKeep),
+		"replay_speed": cfg.ReplaySpeed,
+	} {
+		if n < 0 {
+			fail("$."+key, "must not be negative, got %v", n)
+		}
+	}
+	// The translator parses these; listed here so every problem shows at once.
+	for key, allowed := range map[string][]string{
+		"undo_mode":   {"stroke", "translation"},
+		"untranslate": {"raw", "none", "marker", "buffer"},
+		"space":       {"after", "before"},
+	} {
+		if v := fields[key].String(); v != "" && !contains(allowed, v) {
+			fail("$."+key, "must be one of %s, got %q", strings.Join(allowed, ", "), v)
+		}
+	}
+
+	for _, keys := range sortedKeys(cfg.Layers) {
+		if _, ok := cfg.KeyBindings[keys]; ok {
+			fail("$.layers."+keys, "%s is bound in key_bindings too", keys)
+		}
+	}
+
+	driver, err := machine.Lookup(cfg.Machine)
+	if err != nil {
+		fail("$.machine", "%v", err)
+		sortProblems(problems)
+		return problems
+	}
+	for _, s := range driver.Schema {
+		field, ok := fields[s.Key]
+		if !ok {
+			continue
+		}
+		if s.Required && field.IsZero() {
+			fail("$."+s.Key, "is required for machine %q", driver.Name)
+			continue
+		}
+		if s.Path && field.Kind() == reflect.String && field.String() != "" {
+			if _, err := os.Stat(field.String()); errors.Is(err, fs.ErrNotExist) {
+				warn("$."+s.Key, "%s does not exist yet", field.String())
+			}
+		}
+	}
+	if cfg.Baud < 0 {
+		fail("$.baud_rate", "must be positive, got %d", cfg.Baud)
+	} else if cfg.Baud > 0 && !containsInt(standardBauds, cfg.Baud) {
+		warn("$.baud_rate", "%d is not a standard baud rate", cfg.Baud)
+	}
+	for _, err := range driver.CheckKeys(cfg.CustomKeys) {
+		fail("$.custom_keys."+err.Key, "%v", err.Err)
+	}
+	sortProblems(problems)
+	return problems
+}
+
+// translateKeys are the config keys translating strokes from a file uses.
+var translateKeys = map[string]bool{
+	"dictionaries":       true,
+	"undo_depth":         true,
+	"undo_mode":          true,
+	"untranslate":        true,
+	"untranslate_marker": true,
+	"space":              true,
+	"custom_keys":        true,
+	"layers":             true,
+}
+
+// ValidateTranslate checks only what translating strokes from a file uses:
+// the dictionaries and layers, the translator settings and the custom keys.
+// The custom keys are checked against driver, the machine that decodes the
+// file, and ignored if it has no layout. Of read, the problems Read found, it
+// keeps the warnings and those with these keys.
+func (cfg *Config) ValidateTranslate(driver machine.Driver, read []Problem) []Problem {
+	var problems []Problem
+	for _, p := range read {
+		if p.Warning || translateKeys[topKey(p.Path)] {
+			problems = append(problems, p)
+		}
+	}
+	for _, p := range cfg.Validate() {
+		if key := topKey(p.Path); translateKeys[key] && key != "custom_keys" {
+			problems = append(problems, p)
+		}
+	}
+	if driver.Layout != nil {
+		for _, err := range driver.CheckKeys(cfg.CustomKeys) {
+			problems = append(problems, Problem{Path: "$.custom_keys." + err.Key, Message: err.Err.Error()})
+		}
+	}
+	sortProblems(problems)
+	return problems
+}
+
+// topKey returns the config key a problem's path starts with.
+func topKey(path string) string {
+	key, _, _ := strings.Cut(strings.TrimPrefix(path, "$."), ".")
+	return key
+}
+
+// Check logs the warnings among problems and returns a *ValidationError
+// holding the rest, or nil if there are none.
+func Check(problems []Problem) error {
+	var errs []Problem
+	for _, p := range problems {
+		if p.Warning {
+			log.Printf("config %v", p)
+		} else {
+			errs = append(errs, p)
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Problems: errs}
+	}
+	return nil
+}
+
+// jsonFields maps the JSON names of cfg's fields to the fields themselves.
+func jsonFields(cfg *Config) map[string]reflect.Value {
+	v := reflect.ValueOf(cfg).Elem()
+	fields := make(map[string]reflect.Value, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		fields[name] = v.Field(i)
+	}
+	return fields
+}
+
+// unknownKey explains a key no field has, suggesting the one that only
+// differs in case or underscores, like "time_out" for "timeout".
+func unknownKey(key string, fields map[string]reflect.Value) string {
+	fold := func(s string) string { return strings.ToLower(strings.ReplaceAll(s, "_", "")) }
+	for name := range fields {
+		if fold(name) == fold(key) {
+			return fmt.Sprintf("unknown key, did you mean %q?", name)
+		}
+	}
+	return "unknown key, ignored"
+}
+
+func typeProblem(key string, err error) Problem {
+	path := "$." + key
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field != "" {
+			path += "." + typeErr.Field
+		}
+		return Problem{Path: path, Message: fmt.Sprintf("expected %v, got %s", typeErr.Type, typeErr.Value)}
+	}
+	return Problem{Path: path, Message: err.Error()}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortProblems(problems []Problem) {
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, n int) bool {
+	for _, v := range list {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
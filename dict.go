@@ -0,0 +1,76 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sten/dictionary"
+	"sten/stroke"
+)
+
+// dict manages the dictionary folder: "list" shows what loads, in order,
+// and "add" writes an entry to the user dictionary.
+func dict(args []string) int {
+	fs := flag.NewFlagSet("dict", flag.ContinueOnError)
+	var opts options
+	opts.register(fs, false)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sten dict [flags] list\n       sten dict [flags] add <outline> <translation>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	args = fs.Args()
+	if len(args) == 0 || (args[0] == "list" && len(args) != 1) || (args[0] == "add" && len(args) < 3) {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cfg, err := opts.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sten dict: %v\n", err)
+		return exitConfig
+	}
+	folder := cfg.Dictionaries
+
+	switch args[0] {
+	case "list":
+		paths, err := dictionary.Files(folder)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sten dict: %v\n", err)
+			return exitConfig
+		}
+		for _, path := range paths {
+			entries, err := dictionary.LoadFile(path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "sten dict: %v\n", err)
+				continue
+			}
+			fmt.Printf("%s\t%d entries\n", filepath.Base(path), len(entries))
+		}
+	case "add":
+		translation := strings.Join(args[2:], " ")
+		if err := dictionary.CheckEntry(args[1], translation); err != nil {
+			fmt.Fprintf(os.Stderr, "sten dict: outline %q: %v\n", args[1], err)
+			return exitUsage
+		}
+		outline := stroke.ParseOutline(args[1])
+		if err := dictionary.AddEntry(folder, outline, translation); err != nil {
+			fmt.Fprintf(os.Stderr, "sten dict: %v\n", err)
+			return exitFailure
+		}
+		fmt.Printf("%s\t%s\n", outline, translation)
+	default:
+		fs.Usage()
+		return exitUsage
+	}
+	return exitOK
+}
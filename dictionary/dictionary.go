@@ -4,71 +4,104 @@
 package dictionary
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"sten/stroke"
 	"strings"
+	"sync"
 )
 
 // Dictionary is the interface Translator depends on.
 type Dict interface {
-	Lookup(outline fmt.Stringer) (string, bool)
+	Lookup(outline stroke.Outline) (string, bool)
 }
 
+// Entries that change the engine state. The engine acts on them one stroke
+// at a time, before translation, so only single-stroke outlines can hold
+// them.
+const (
+	CommandToggle  = "{PLOVER:TOGGLE}"
+	CommandSuspend = "{PLOVER:SUSPEND}"
+	CommandResume  = "{PLOVER:RESUME}"
+)
+
+// CheckEntry reports an entry that cannot be used: steno that does not parse
+// as written, or a state command on more than one stroke.
+func CheckEntry(steno, translation string) error {
+	if err := stroke.CheckOutline(steno); err != nil {
+		return err
+	}
+	switch translation {
+	case CommandToggle, CommandSuspend, CommandResume:
+		if strings.Contains(steno, "/") {
+			return fmt.Errorf("%s must be a single stroke", translation)
+		}
+	}
+	return nil
+}
+
+// Dictionary keeps its entries in a trie of parsed strokes, so steno
+// spellings that parse to the same strokes share an entry and lookups don't
+// build strings.
 type Dictionary struct {
-	entries map[string]string
+	root *Node
+	size int // distinct outlines in root
+
+	once    sync.Once
+	reverse *reverse // built by index on the first search
 }
 
 func LoadDictionaries(folder string) (Dict, int, error) {
-	entries := make(map[string]string)
-	combined := &Dictionary{
-		entries: entries,
-	}
+	combined := &Dictionary{root: newNode()}
 	longestOutline := 0
 
-	files, err := os.ReadDir(folder)
+	paths, err := Files(folder)
 	if err != nil {
-		return nil, longestOutline, fmt.Errorf("read dir: %w", err)
+		return nil, longestOutline, err
 	}
 
-	for _, entry := range files {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
-			continue
-		}
-
-		path := filepath.Join(folder, entry.Name())
-		f, err := os.Open(path)
+	for _, path := range paths {
+		dict, err := LoadFile(path)
 		if err != nil {
-			log.Printf("failed to open %s: %v", entry.Name(), err)
-			continue
-		}
-		defer f.Close()
-
-		var dict map[string]string
-		if err := json.NewDecoder(f).Decode(&dict); err != nil {
-			log.Printf("failed to decode %s: %v", entry.Name(), err)
+			log.Printf("%v", err)
 			continue
 		}
 
 		for k, v := range dict {
-			combined.entries[k] = v
+			if err := CheckEntry(k, v); err != nil {
+				log.Printf("%s: skipping %q: %v", path, k, err)
+				continue
+			}
+			outline := stroke.ParseOutline(k)
+			combined.add(outline, v)
 
-			// Count strokes: number of slashes + 1
-			count := strings.Count(k, "/") + 1
-			if count > longestOutline {
-				longestOutline = count
+			if len(outline) > longestOutline {
+				longestOutline = len(outline)
 			}
 		}
 	}
 
-	fmt.Printf("Loaded %d entries across dictionaries. Max outline length: %d strokes.\n", len(combined.entries), longestOutline)
+	log.Printf("Loaded %d entries across dictionaries. Max outline length: %d strokes.", combined.Len(), longestOutline)
 
 	return combined, longestOutline, nil
 }
 
-func (d *Dictionary) Lookup(outline fmt.Stringer) (string, bool) {
-	result, ok := d.entries[outline.String()]
-	return result, ok
+func (d *Dictionary) add(outline stroke.Outline, entry string) {
+	if d.root.insert(outline, entry) {
+		d.size++
+	}
+}
+
+func (d *Dictionary) Lookup(outline stroke.Outline) (string, bool) {
+	return d.root.Walk(outline).Entry()
+}
+
+// Len returns the number of distinct outlines in the dictionary.
+func (d *Dictionary) Len() int {
+	return d.size
+}
+
+// Root returns the trie the entries are kept in.
+func (d *Dictionary) Root() *Node {
+	return d.root
 }
@@ -5,9 +5,11 @@
 package dictionary
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"sten/stroke"
+	"strings"
 	"testing"
 )
 
@@ -66,9 +68,175 @@ func TestLoadDictionary(t *testing.T) {
 		t.Errorf("expected %q, counted %q", 5, maxOutline)
 	}
 
-	got, _ := dict.Lookup(stroke.ParseSteno("STKPWHRAEU"))
+	got, _ := dict.Lookup(stroke.ParseSteno("STKPWHRAEU").Outline())
 	want := "display"
 	if got != want {
 		t.Errorf("expected %q, got %q", want, got)
 	}
+
+	// Spellings that parse to the same strokes find the same entry.
+	got, _ = dict.Lookup(stroke.ParseOutline("STKPWAO/STKPWAO/HRO/SKWR-EUBG/KWR-AL"))
+	if got != "zoological" {
+		t.Errorf("expected %q, got %q", "zoological", got)
+	}
+
+	root := dict.(Prefixer).Root()
+	prefix := root.Walk(stroke.ParseOutline("STKPWAO/STKPWAO"))
+	if prefix == nil {
+		t.Fatalf("expected STKPWAO/STKPWAO to be a prefix of zoological")
+	}
+	if _, ok := prefix.Entry(); ok {
+		t.Errorf("expected no entry for STKPWAO/STKPWAO")
+	}
+	got, _ = prefix.Walk(stroke.ParseOutline("HRO/SKWREUBG/KWRAL")).Entry()
+	if got != "zoological" {
+		t.Errorf("expected %q, got %q", "zoological", got)
+	}
+	if root.Walk(stroke.ParseOutline("STKPWAO/TPHOEPB")) != nil {
+		t.Errorf("expected STKPWAO/TPHOEPB to prune")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	tmp := `{
+		"WORLD": "world",
+		"WORLD/-D": "world",
+		"WO*RLD": "{^world}",
+		"WORLDZ": "worlds",
+		"WOERD": "word",
+		"-G": "{^ing}",
+		"KPA": "{-|}"
+	}`
+	if err := os.WriteFile(filepath.Join(dir, "test_dict.json"), []byte(tmp), 0644); err != nil {
+		t.Fatalf("failed to write test dict: %v", err)
+	}
+	dict, _, err := LoadDictionaries(dir)
+	if err != nil {
+		t.Fatalf("failed to load dictionary: %v", err)
+	}
+	s := dict.(Searcher)
+
+	cases := []struct {
+		name     string
+		text     string
+		mode     SearchMode
+		limit    int
+		expected []string // translation: outlines
+	}{
+		{"Exact", "world", SearchExact, 0, []string{"world: WORLD, WORLD/-D", "{^world}: WO*RLD"}},
+		{"Exact Affix", "ing", SearchExact, 0, []string{"{^ing}: -G"}},
+		{"Exact Case", "World", SearchExact, 0, nil},
+		{"Prefix", "WORL", SearchPrefix, 0, []string{"world: WORLD, WORLD/-D", "{^world}: WO*RLD", "worlds: WORLDZ"}},
+		{"Prefix Limit", "worl", SearchPrefix, 1, []string{"world: WORLD, WORLD/-D"}},
+		{"Fuzzy", "wrold", SearchFuzzy, 0, []string{"world: WORLD, WORLD/-D", "{^world}: WO*RLD", "word: WOERD", "worlds: WORLDZ"}},
+		{"Fuzzy Short", "wrd", SearchFuzzy, 0, []string{"word: WOERD"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, m := range s.Search(tc.text, tc.mode, tc.limit) {
+				got = append(got, describe(m))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.expected) {
+				t.Errorf("want %q, got %q", tc.expected, got)
+			}
+		})
+	}
+
+	var got []string
+	for _, m := range s.SearchOutline(stroke.ParseOutline("WORLD"), 0) {
+		got = append(got, describe(m))
+	}
+	want := []string{"world: WORLD", "world: WORLD/-D"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func describe(m Match) string {
+	outlines := make([]string, len(m.Outlines))
+	for i, o := range m.Outlines {
+		outlines[i] = o.String()
+	}
+	return m.Translation + ": " + strings.Join(outlines, ", ")
+}
+
+func TestUserDictionary(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "z_dict.json"), []byte(`{"WORLD": "world", "KOPL": "come"}`), 0644); err != nil {
+		t.Fatalf("failed to write test dict: %v", err)
+	}
+	if err := AddEntry(dir, stroke.ParseOutline("WORLD"), "planet"); err != nil {
+		t.Fatalf("failed to add entry: %v", err)
+	}
+	if err := AddEntry(dir, stroke.ParseOutline("KOPL/PHRAOET"), "complete"); err != nil {
+		t.Fatalf("failed to add entry: %v", err)
+	}
+
+	paths, err := Files(dir)
+	if err != nil {
+		t.Fatalf("failed to list dictionaries: %v", err)
+	}
+	if len(paths) != 2 || filepath.Base(paths[1]) != UserDictionary {
+		t.Errorf("expected the user dictionary to load last, got %v", paths)
+	}
+
+	dict, _, err := LoadDictionaries(dir)
+	if err != nil {
+		t.Fatalf("failed to load dictionary: %v", err)
+	}
+	for steno, want := range map[string]string{"WORLD": "planet", "KOPL": "come", "KOPL/PHRAOET": "complete"} {
+		if got, _ := dict.Lookup(stroke.ParseOutline(steno)); got != want {
+			t.Errorf("%s: want %q, got %q", steno, want, got)
+		}
+	}
+}
+
+func TestNumberSteno(t *testing.T) {
+	dir := t.TempDir()
+	tmp := `{
+		"1-D": "first",
+		"-D": "{^ed}",
+		"12": "twelve",
+		"hello": "not steno"
+	}`
+	if err := os.WriteFile(filepath.Join(dir, "test_dict.json"), []byte(tmp), 0644); err != nil {
+		t.Fatalf("failed to write test dict: %v", err)
+	}
+	dict, _, err := LoadDictionaries(dir)
+	if err != nil {
+		t.Fatalf("failed to load dictionary: %v", err)
+	}
+
+	// Digits hold the number bar, so they don't collide with the keys alone.
+	for steno, want := range map[string]string{"#S-D": "first", "-D": "{^ed}", "#ST": "twelve"} {
+		if got, _ := dict.Lookup(stroke.ParseOutline(steno)); got != want {
+			t.Errorf("%s: expected %q, got %q", steno, want, got)
+		}
+	}
+	if n := dict.(*Dictionary).Len(); n != 3 {
+		t.Errorf("expected 3 entries with the bad steno skipped, got %d", n)
+	}
+}
+
+func TestCheckEntry(t *testing.T) {
+	cases := []struct {
+		steno       string
+		translation string
+		wantErr     bool
+	}{
+		{"PHROLG", CommandToggle, false},
+		{"PHROLG/PHROLG", CommandToggle, true},
+		{"PHRUS/PHRUS", CommandSuspend, true},
+		{"PHRES/PHRES", CommandResume, true},
+		{"KOPL/PHRAOET", "complete", false},
+		{"KOPL/QET", "complete", true},
+	}
+	for _, tc := range cases {
+		err := CheckEntry(tc.steno, tc.translation)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s %s: want error %v, got %v", tc.steno, tc.translation, tc.wantErr, err)
+		}
+	}
 }
@@ -0,0 +1,86 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+package dictionary
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sten/stroke"
+	"strings"
+)
+
+// UserDictionary is the file in the dictionary folder that entries are
+// added to. It loads last, so its entries override the rest.
+const UserDictionary = "user.json"
+
+// Files returns the dictionaries in folder in the order they load: by name,
+// then the user dictionary. Later files override earlier ones.
+func Files(folder string) ([]string, error) {
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		return nil, fmt.Errorf("read dir: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return names[i] != UserDictionary && names[j] == UserDictionary
+	})
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(folder, name)
+	}
+	return paths, nil
+}
+
+// LoadFile reads one dictionary file as written, steno to translation.
+func LoadFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filepath.Base(path), err)
+	}
+	defer f.Close()
+
+	var dict map[string]string
+	if err := json.NewDecoder(f).Decode(&dict); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", filepath.Base(path), err)
+	}
+	return dict, nil
+}
+
+// AddEntry writes outline and its translation into the user dictionary in
+// folder, creating it if needed, and replacing any entry the outline had.
+func AddEntry(folder string, outline stroke.Outline, translation string) error {
+	path := filepath.Join(folder, UserDictionary)
+	dict, err := LoadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		dict, err = make(map[string]string), nil
+	}
+	if err != nil {
+		return err
+	}
+	dict[outline.String()] = translation
+
+	data, err := json.MarshalIndent(dict, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", UserDictionary, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("could not write %s: %w", UserDictionary, err)
+	}
+	return nil
+}
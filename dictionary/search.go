@@ -0,0 +1,218 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+package dictionary
+
+import (
+	"math/bits"
+	"sort"
+	"sten/stroke"
+	"strings"
+)
+
+// SearchMode selects how Search compares text with translations.
+type SearchMode int
+
+const (
+	// SearchExact finds translations that read exactly as the text.
+	SearchExact SearchMode = iota
+	// SearchPrefix finds translations starting with the text, ignoring case.
+	SearchPrefix
+	// SearchFuzzy finds translations a typo or two away from the text,
+	// ignoring case, closest first.
+	SearchFuzzy
+)
+
+// Match is a translation and the outlines that write it, shortest first.
+type Match struct {
+	Translation string
+	Outlines    []stroke.Outline
+}
+
+// Searcher is implemented by dictionaries that can be searched backwards,
+// from text to the outlines that write it.
+type Searcher interface {
+	Search(text string, mode SearchMode, limit int) []Match
+	SearchOutline(prefix stroke.Outline, limit int) []Match
+}
+
+// reverse indexes translations by the text they read as, which drops the
+// {^ } and {& } markers around affixes and glue.
+type reverse struct {
+	outlines map[string][]stroke.Outline // by translation
+	words    []indexed                   // sorted by key
+}
+
+type indexed struct {
+	key         string // folded plain text
+	translation string
+}
+
+// plain returns the text of a translation without its attach markers.
+func plain(translation string) string {
+	return strings.TrimRight(strings.TrimLeft(translation, "{^&}"), "^}")
+}
+
+// index builds the reverse index the first time a search needs it, so
+// translating never pays for it.
+func (d *Dictionary) index() *reverse {
+	d.once.Do(func() {
+		r := &reverse{outlines: make(map[string][]stroke.Outline)}
+		d.root.each(nil, func(outline stroke.Outline, translation string) {
+			if _, ok := r.outlines[translation]; !ok {
+				r.words = append(r.words, indexed{strings.ToLower(plain(translation)), translation})
+			}
+			r.outlines[translation] = append(r.outlines[translation], outline)
+		})
+		for _, outlines := range r.outlines {
+			sortOutlines(outlines)
+		}
+		sort.Slice(r.words, func(i, j int) bool {
+			if r.words[i].key != r.words[j].key {
+				return r.words[i].key < r.words[j].key
+			}
+			return r.words[i].translation < r.words[j].translation
+		})
+		d.reverse = r
+	})
+	return d.reverse
+}
+
+// Search returns up to limit translations matching text, or all of them if
+// limit is 0.
+func (d *Dictionary) Search(text string, mode SearchMode, limit int) []Match {
+	r := d.index()
+	key := strings.ToLower(text)
+	first := sort.Search(len(r.words), func(i int) bool { return r.words[i].key >= key })
+
+	var found []indexed
+	switch mode {
+	case SearchExact:
+		for _, w := range r.words[first:] {
+			if w.key != key {
+				break
+			}
+			if plain(w.translation) == text {
+				found = append(found, w)
+			}
+		}
+	case SearchPrefix:
+		for _, w := range r.words[first:] {
+			if !strings.HasPrefix(w.key, key) {
+				break
+			}
+			found = append(found, w)
+		}
+	case SearchFuzzy:
+		found = fuzzy(r.words, key)
+	}
+
+	if limit > 0 && len(found) > limit {
+		found = found[:limit]
+	}
+	matches := make([]Match, len(found))
+	for i, w := range found {
+		matches[i] = Match{w.translation, r.outlines[w.translation]}
+	}
+	return matches
+}
+
+// SearchOutline returns up to limit entries whose outlines start with
+// prefix, shortest outlines first, or all of them if limit is 0.
+func (d *Dictionary) SearchOutline(prefix stroke.Outline, limit int) []Match {
+	var matches []Match
+	d.root.Walk(prefix).each(prefix, func(outline stroke.Outline, translation string) {
+		matches = append(matches, Match{translation, []stroke.Outline{outline}})
+	})
+	sort.Slice(matches, func(i, j int) bool {
+		return outlineLess(matches[i].Outlines[0], matches[j].Outlines[0])
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// fuzzy returns the words within a small edit distance of key, closest
+// first. Longer words allow more typos.
+func fuzzy(words []indexed, key string) []indexed {
+	maxDist := 1
+	if len([]rune(key)) > 4 {
+		maxDist = 2
+	}
+	type scored struct {
+		indexed
+		dist int
+	}
+	var found []scored
+	for _, w := range words {
+		if d := distance(w.key, key, maxDist); d <= maxDist {
+			found = append(found, scored{w, d})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].dist < found[j].dist })
+	result := make([]indexed, len(found))
+	for i, s := range found {
+		result[i] = s.indexed
+	}
+	return result
+}
+
+// distance counts the insertions, deletions, substitutions and swaps of
+// neighbouring runes between a and b. It gives up early with a number above
+// limit once the distance is sure to exceed it.
+func distance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if diff := len(ra) - len(rb); diff > limit || -diff > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		best := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			best = min(best, cur[j])
+		}
+		if best > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
+
+func sortOutlines(outlines []stroke.Outline) {
+	sort.Slice(outlines, func(i, j int) bool { return outlineLess(outlines[i], outlines[j]) })
+}
+
+// outlineLess orders outlines by strokes, then keys, then steno.
+func outlineLess(a, b stroke.Outline) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	if ka, kb := keyCount(a), keyCount(b); ka != kb {
+		return ka < kb
+	}
+	return a.String() < b.String()
+}
+
+func keyCount(outline stroke.Outline) int {
+	n := 0
+	for _, s := range outline {
+		n += bits.OnesCount32(uint32(s))
+	}
+	return n
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+package dictionary
+
+import (
+	"sten/stroke"
+)
+
+// Prefixer is implemented by dictionaries that index their outlines stroke by
+// stroke, so a caller can stop as soon as no entry starts with what it has.
+type Prefixer interface {
+	Root() *Node
+}
+
+// Node is one stroke deep in a trie of outlines.
+type Node struct {
+	children map[stroke.Stroke]*Node
+	entry    string
+	ok       bool
+}
+
+func newNode() *Node {
+	return &Node{children: make(map[stroke.Stroke]*Node)}
+}
+
+// insert sets the entry for outline and reports whether it is a new one.
+func (n *Node) insert(outline stroke.Outline, entry string) bool {
+	for _, s := range outline {
+		child, ok := n.children[s]
+		if !ok {
+			child = newNode()
+			n.children[s] = child
+		}
+		n = child
+	}
+	added := !n.ok
+	n.entry, n.ok = entry, true
+	return added
+}
+
+// Child returns the node one stroke further on, or nil if no outline
+// continues with s.
+func (n *Node) Child(s stroke.Stroke) *Node {
+	if n == nil {
+		return nil
+	}
+	return n.children[s]
+}
+
+// Walk follows outline from n and returns nil as soon as no outline can match.
+func (n *Node) Walk(outline stroke.Outline) *Node {
+	for _, s := range outline {
+		if n = n.Child(s); n == nil {
+			return nil
+		}
+	}
+	return n
+}
+
+// Entry returns the translation of the outline that ends at n.
+func (n *Node) Entry() (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	return n.entry, n.ok
+}
+
+// each calls fn with every entry at or below n, where outline is the path
+// that leads to n.
+func (n *Node) each(outline stroke.Outline, fn func(stroke.Outline, string)) {
+	if n == nil {
+		return
+	}
+	if n.ok {
+		fn(append(stroke.Outline(nil), outline...), n.entry)
+	}
+	for s, child := range n.children {
+		child.each(append(outline[:len(outline):len(outline)], s), fn)
+	}
+}
@@ -5,62 +5,339 @@
 package engine
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"sten/config"
 	"sten/dictionary"
 	"sten/machine"
 	"sten/output"
+	"sten/stroke"
+	"sten/strokelog"
 	"sten/translator"
+	"strings"
+	"sync"
+	"time"
 )
 
+// DefaultDictionaries is the folder dictionaries load from when the config
+// does not name one.
+const DefaultDictionaries = "dictionaries"
+
 type Engine struct {
 	cfg        *config.Config
 	machine    machine.Machine
 	translator *translator.Translator
 	output     output.OutputService
-	stop       chan struct{}
+	logger     *strokelog.Logger
+	dict       dictionary.Dict
+	layers     translator.Layers
+	bindings   map[string]stroke.Stroke // from key_bindings
+	cfgMu      sync.Mutex               // guards cfg, machine, dict, layers and bindings across Reload
+	reloadMu   sync.Mutex               // lets one Reload run at a time
+	swaps      chan swap                // machines Reload hands to capture
+	captured   chan stroke.Capture      // from whichever machine is open
+	strokes    chan stroke.Capture      // captured, through the stroke log
+	gated      chan stroke.Capture      // to the translator, while running
+	runMu      sync.Mutex               // guards cancel and done
+	cancel     context.CancelFunc
+	done       chan struct{} // closed when Run returns
+	stateMu    sync.Mutex
+	state      State
+	states     chan StateChange
+	snapshotMu sync.Mutex
+	snapshot   []byte // last snapshot written, to skip unchanged saves
+
+	shutdownOnce sync.Once
 }
 
-func NewEngine(cfg *config.Config) *Engine {
-	// Load your dictionary
-	dict, longestOutline, err := dictionary.LoadDictionaries("dictionaries")
+// NewEngine builds the pipeline described by cfg. Errors are a *ConfigError
+// for settings it cannot use and a *StageError for parts that fail to load.
+func NewEngine(cfg *config.Config) (*Engine, error) {
+	dict, layers, longestOutline, err := LoadDictionaries(cfg)
+	if err != nil {
+		return nil, err
+	}
+	driver, err := machine.Lookup(cfg.Machine)
+	if err != nil {
+		return nil, &ConfigError{Key: "machine", Err: err}
+	}
+	if !cfg.Dev {
+		return nil, &ConfigError{Key: "dev", Err: ErrNoOutput}
+	}
+	m, err := newMachine(driver, cfg)
 	if err != nil {
-		log.Fatalf("Error loading dictionary: %v", err)
+		return nil, err
 	}
+	newOutput := func(outputs chan output.Output) output.OutputService {
+		return output.NewDevOutputService(outputs)
+	}
+	return newEngine(cfg, dict, layers, longestOutline, m, newOutput)
+}
 
-	var o output.OutputService
-	var m machine.Machine
-	if cfg.Machine == "geminipr" {
-		m = machine.NewGeminiPrMachine(cfg.Port, cfg.Baud)
-	} else {
-		log.Fatalf("Unknown machine type: %v", cfg.Machine)
+// LoadDictionaries loads the folder cfg names, or DefaultDictionaries, and
+// the folder of each layer. The int is the longest outline in any of them.
+// Errors are a *StageError for the main folder and a *ConfigError for a
+// layer.
+func LoadDictionaries(cfg *config.Config) (dictionary.Dict, translator.Layers, int, error) {
+	folder := cfg.Dictionaries
+	if folder == "" {
+		folder = DefaultDictionaries
+	}
+	dict, longestOutline, err := dictionary.LoadDictionaries(folder)
+	if err != nil {
+		return nil, nil, 0, &StageError{Stage: "dictionary", Err: err}
 	}
-	t := translator.NewTranslator(dict, longestOutline, m.Strokes())
-	if cfg.Dev {
-		o = output.NewDevOutputService(t.Out())
-	} else {
-		log.Fatalf("Non-dev mode output not implemented!")
+	var layers translator.Layers
+	for keys, folder := range cfg.Layers {
+		layer, n, err := dictionary.LoadDictionaries(folder)
+		if err != nil {
+			return nil, nil, 0, &ConfigError{Key: "layers", Err: fmt.Errorf("%s: %w", keys, err)}
+		}
+		if layers == nil {
+			layers = make(translator.Layers)
+		}
+		layers[keys] = layer
+		longestOutline = max(longestOutline, n)
 	}
+	return dict, layers, longestOutline, nil
+}
 
+// newMachine builds, without opening, the machine cfg describes. Custom keys
+// the driver's layout cannot take are a *ConfigError.
+func newMachine(driver machine.Driver, cfg *config.Config) (machine.Machine, error) {
+	if errs := driver.CheckKeys(cfg.CustomKeys); len(errs) > 0 {
+		return nil, &ConfigError{Key: "custom_keys", Err: errs[0]}
+	}
+	m, err := driver.New(machine.Settings{
+		Port:  cfg.Port,
+		Baud:  cfg.Baud,
+		File:  cfg.ReplayFile,
+		Speed: cfg.ReplaySpeed,
+		Keys:  cfg.CustomKeys,
+
+		ReadTimeout: time.Duration(cfg.ReadTimeout) * time.Millisecond,
+	})
+	if err != nil {
+		return nil, &StageError{Stage: "machine", Err: err}
+	}
+	return m, nil
+}
+
+// newEngine wires strokes from m through the translator to the output that
+// newOutput builds.
+func newEngine(cfg *config.Config, dict dictionary.Dict, layers translator.Layers, outlineCap int, m machine.Machine, newOutput func(chan output.Output) output.OutputService) (*Engine, error) {
+	opts, err := TranslatorOptions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := parseBindings(cfg.KeyBindings)
+	if err != nil {
+		return nil, err
+	}
 	e := &Engine{
-		cfg:        cfg,
-		machine:    m,
-		output:     o,
-		translator: t,
-		stop:       make(chan struct{}),
+		cfg:      cfg,
+		machine:  m,
+		dict:     dict,
+		layers:   layers,
+		bindings: bindings,
+		swaps:    make(chan swap),
+		captured: make(chan stroke.Capture, cap(m.Strokes())),
+		states:   make(chan StateChange, 16),
+	}
+	strokes := e.captured
+	if cfg.LogPath != "" {
+		e.logger, err = strokelog.Open(cfg.LogPath, cfg.LogMaxSize, cfg.LogKeep)
+		if err != nil {
+			return nil, &StageError{Stage: "stroke log", Err: err}
+		}
+		strokes = e.logger.TeeStrokes(strokes)
+	}
+	e.strokes = strokes
+	e.gated = make(chan stroke.Capture, cap(strokes))
+	opts = append(opts, translator.WithLayers(layers))
+	e.translator = translator.NewTranslator(dict, outlineCap, e.gated, opts...)
+	outputs := e.translator.Out()
+	if e.logger != nil {
+		outputs = e.logger.TeeOutputs(outputs)
+	}
+	e.output = newOutput(outputs)
+
+	if cfg.Snapshot != "" {
+		if err := e.loadSnapshot(cfg.Snapshot); err != nil {
+			log.Printf("Not resuming from snapshot: %v", err)
+		}
+	}
+	return e, nil
+}
+
+// TranslatorOptions returns the translator options set in cfg, or a
+// *ConfigError for a value the translator does not know.
+func TranslatorOptions(cfg *config.Config) ([]translator.Option, error) {
+	var opts []translator.Option
+	if cfg.UndoDepth > 0 {
+		opts = append(opts, translator.WithUndoDepth(cfg.UndoDepth))
+	}
+	if cfg.UndoMode != "" {
+		mode, err := translator.ParseUndoMode(cfg.UndoMode)
+		if err != nil {
+			return nil, &ConfigError{Key: "undo_mode", Err: err}
+		}
+		opts = append(opts, translator.WithUndoMode(mode))
+	}
+	if cfg.Untranslate != "" {
+		mode, err := translator.ParseUntranslateMode(cfg.Untranslate)
+		if err != nil {
+			return nil, &ConfigError{Key: "untranslate", Err: err}
+		}
+		opts = append(opts, translator.WithUntranslateMode(mode))
+	}
+	if cfg.Space != "" {
+		mode, err := translator.ParseSpaceMode(cfg.Space)
+		if err != nil {
+			return nil, &ConfigError{Key: "space", Err: err}
+		}
+		opts = append(opts, translator.WithSpaceMode(mode))
+	}
+	if cfg.Marker != "" {
+		opts = append(opts, translator.WithUntranslateMarker(cfg.Marker))
+	}
+	return opts, nil
+}
+
+// Remap lays keys over the machine's default layout while it runs, in
+// place of the custom keys it was built with.
+func (e *Engine) Remap(keys map[string]string) error {
+	e.cfgMu.Lock()
+	m, name := e.machine, e.cfg.Machine
+	e.cfgMu.Unlock()
+	r, ok := m.(machine.Remapper)
+	if !ok {
+		return fmt.Errorf("machine %q has no key layout to remap", name)
+	}
+	return r.Remap(keys)
+}
+
+// Run starts the pipeline and blocks until ctx is done, Stop is called or
+// the machine runs out of strokes. Stopping the machine ends the pipeline
+// from the front: strokes already captured are still translated and typed
+// before Run returns. A stage that fails stops the rest, and Run returns
+// its *StageError.
+func (e *Engine) Run(ctx context.Context) error {
+	e.runMu.Lock()
+	if e.done != nil {
+		// Already run or stopped; an engine runs once.
+		e.runMu.Unlock()
+		return nil
+	}
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.done = make(chan struct{})
+	e.runMu.Unlock()
+	defer close(e.done)
+	defer e.shutdown()
+
+	g, ctx := newGroup(ctx)
+	g.run("machine", func() error {
+		return e.capture(ctx)
+	})
+	g.run("gate", func() error {
+		e.gate()
+		return nil
+	})
+	g.run("translator", func() error {
+		e.translator.Run()
+		return nil
+	})
+	g.run("output", func() error {
+		e.output.Run()
+		// Everything captured has been typed, so there is nothing left
+		// for the other stages to do.
+		g.cancel()
+		return nil
+	})
+	g.run("report", func() error {
+		e.report()
+		return nil
+	})
+	if e.config().Snapshot != "" {
+		g.run("snapshot", func() error {
+			e.snapshotLoop(ctx)
+			return nil
+		})
+	}
+	return g.wait()
+}
+
+// snapshotLoop saves the snapshot every snapshotInterval until ctx is done.
+func (e *Engine) snapshotLoop(ctx context.Context) {
+	ticker := time.NewTicker(snapshotInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.saveSnapshot(e.config().Snapshot); err != nil {
+				log.Printf("Error saving snapshot: %v", err)
+			}
+		}
 	}
-	return e
 }
 
-func (e *Engine) Run() {
-	// Start machine capture
-	go e.machine.StartCapture()
-	go e.translator.Run()
-	go e.output.Run()
-	<-e.stop
+// report logs the translator events meant for the writer, such as lookup
+// results, until the translator stops.
+func (e *Engine) report() {
+	for ev := range e.translator.Events() {
+		if ev.Kind != translator.EventLookup {
+			continue
+		}
+		if len(ev.Matches) == 0 {
+			log.Printf("Lookup %q: no matches", ev.Text)
+			continue
+		}
+		for _, m := range ev.Matches {
+			outlines := make([]string, len(m.Outlines))
+			for i, o := range m.Outlines {
+				outlines[i] = o.String()
+			}
+			log.Printf("Lookup %q: %s\t%s", ev.Text, m.Translation, strings.Join(outlines, ", "))
+		}
+	}
 }
 
+// Stop ends Run and blocks until the pipeline has drained and every
+// goroutine it started has returned.
 func (e *Engine) Stop() {
-	e.machine.StopCapture()
-	close(e.stop) // unblocks Run()}
+	e.runMu.Lock()
+	if e.done == nil {
+		// Never started, so there is nothing to wait for.
+		e.done = make(chan struct{})
+		close(e.done)
+		e.runMu.Unlock()
+		e.currentMachine().StopCapture()
+		e.shutdown()
+		return
+	}
+	cancel, done := e.cancel, e.done
+	e.runMu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	<-done
+}
+
+// shutdown saves the final snapshot and closes the stroke log, once the
+// translator has seen every stroke.
+func (e *Engine) shutdown() {
+	e.shutdownOnce.Do(func() {
+		e.setState(Stopped)
+		if path := e.config().Snapshot; path != "" {
+			if err := e.saveSnapshot(path); err != nil {
+				log.Printf("Error saving snapshot: %v", err)
+			}
+		}
+		if e.logger != nil {
+			e.logger.Close()
+		}
+	})
 }
@@ -4,33 +4,526 @@
 
 package engine
 
-//func TestEngineTranslate(t *testing.T) {
-//	// Manually set the layout used for translation
-//	config.Layout = map[string]string{
-//		"S2-": "S",
-//		"T-":  "T",
-//		"K-":  "K",
-//		"E":   "E",
-//		"P-":  "P",
-//		"W-":  "W",
-//	}
-//
-//	dict := map[string]string{
-//		"STKE": "stack",
-//		"TKPW": "go",
-//	}
-//
-//	e := NewEngine(dict)
-//
-//	if word := e.TranslateSteno([]string{"S2-", "T-", "K-", "E"}); word != "stack" {
-//		t.Errorf("expected stack, got %q", word)
-//	}
-//
-//	if word := e.TranslateSteno([]string{"T-", "K-", "P-", "W-"}); word != "go" {
-//		t.Errorf("expected go, got %q", word)
-//	}
-//
-//	if word := e.TranslateSteno([]string{"X", "Y", "Z"}); word != "[]" {
-//		t.Errorf("expected empty string, got %q", word)
-//	}
-//}
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sten/config"
+	"sten/machine"
+	"sten/output"
+	"sten/stroke"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MockDictionary is a basic stub for dictionary.Dictionary
+type MockDictionary struct {
+	entries map[string]string
+}
+
+func (m *MockDictionary) Lookup(outline stroke.Outline) (string, bool) {
+	val, ok := m.entries[outline.String()]
+	return val, ok
+}
+
+// FakeMachine sends whatever strokes the test gives it.
+type FakeMachine struct {
+	strokes  chan stroke.Capture
+	once     sync.Once
+	stopped  bool
+	startErr error
+}
+
+func NewFakeMachine() *FakeMachine {
+	return &FakeMachine{strokes: make(chan stroke.Capture)}
+}
+
+func (m *FakeMachine) StartCapture() error {
+	if m.startErr != nil {
+		m.end()
+	}
+	return m.startErr
+}
+
+func (m *FakeMachine) StopCapture() {
+	m.stopped = true
+	m.end()
+}
+
+func (m *FakeMachine) Strokes() chan stroke.Capture { return m.strokes }
+
+// end closes the stroke channel, as a real machine does when capture ends.
+func (m *FakeMachine) end() {
+	m.once.Do(func() { close(m.strokes) })
+}
+
+func (m *FakeMachine) send(steno ...string) {
+	for _, s := range steno {
+		m.strokes <- stroke.Capture{Stroke: stroke.ParseSteno(s)}
+	}
+}
+
+// sendExtra sends a stroke of only extra keys.
+func (m *FakeMachine) sendExtra(keys ...string) {
+	m.strokes <- stroke.Capture{Extra: keys}
+}
+
+// sendChord sends a stroke of steno keys held with extra keys.
+func (m *FakeMachine) sendChord(steno string, keys ...string) {
+	m.strokes <- stroke.Capture{Stroke: stroke.ParseSteno(steno), Extra: keys}
+}
+
+// RecordingOutput keeps everything it is asked to type.
+type RecordingOutput struct {
+	in   chan output.Output
+	got  []output.Output
+	done chan struct{}
+}
+
+func (o *RecordingOutput) Run() {
+	defer close(o.done)
+	for out := range o.in {
+		o.got = append(o.got, out)
+	}
+}
+
+// newTestEngine builds an engine around a fake machine and a recording
+// output.
+func newTestEngine(t *testing.T, dict map[string]string) (*Engine, *FakeMachine, *RecordingOutput) {
+	t.Helper()
+	return newTestEngineConfig(t, &config.Config{}, dict)
+}
+
+func newTestEngineConfig(t *testing.T, cfg *config.Config, dict map[string]string) (*Engine, *FakeMachine, *RecordingOutput) {
+	t.Helper()
+	m := NewFakeMachine()
+	rec := &RecordingOutput{done: make(chan struct{})}
+	e, err := newEngine(cfg, &MockDictionary{dict}, nil, 1, m, func(in chan output.Output) output.OutputService {
+		rec.in = in
+		return rec
+	})
+	if err != nil {
+		t.Fatalf("failed to build engine: %v", err)
+	}
+	return e, m, rec
+}
+
+var testDict = map[string]string{
+	"U":      "you",
+	"KOPL":   "come",
+	"PHROLG": "{PLOVER:TOGGLE}",
+	"PHRUS":  "{PLOVER:SUSPEND}",
+	"PHRES":  "{PLOVER:RESUME}",
+}
+
+func TestToggle(t *testing.T) {
+	cases := []struct {
+		name     string
+		strokes  []string
+		expected []string
+		states   []State
+	}{
+		{
+			name:     "Running",
+			strokes:  []string{"U", "KOPL"},
+			expected: []string{"you ", "come "},
+		},
+		{
+			name:     "Toggle",
+			strokes:  []string{"U", "PHROLG", "KOPL", "U", "PHROLG", "KOPL"},
+			expected: []string{"you ", "come "},
+			states:   []State{Suspended, Running},
+		},
+		{
+			name:     "Suspend And Resume",
+			strokes:  []string{"PHRUS", "U", "PHRUS", "KOPL", "PHRES", "U", "PHRES"},
+			expected: []string{"you "},
+			states:   []State{Suspended, Running},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, m, rec := newTestEngine(t, testDict)
+			go e.Run(context.Background())
+			m.send(tc.strokes...)
+			e.Stop()
+
+			if len(rec.got) != len(tc.expected) {
+				t.Fatalf("expected %d outputs, got %d: %+v", len(tc.expected), len(rec.got), rec.got)
+			}
+			for i, want := range tc.expected {
+				if rec.got[i].Write != want {
+					t.Errorf("at %d: want %q, got %q", i, want, rec.got[i].Write)
+				}
+			}
+
+			from := Running
+			for i, want := range append(tc.states, Stopped) {
+				change := <-e.States()
+				if change.From != from || change.To != want {
+					t.Errorf("at %d: want %v -> %v, got %v -> %v", i, from, want, change.From, change.To)
+				}
+				from = want
+			}
+			if !m.stopped {
+				t.Errorf("machine was not stopped")
+			}
+		})
+	}
+}
+
+func TestToggleAPI(t *testing.T) {
+	e, _, _ := newTestEngine(t, testDict)
+	if e.State() != Running {
+		t.Fatalf("expected a new engine to be running, got %v", e.State())
+	}
+	e.Toggle()
+	if e.State() != Suspended {
+		t.Errorf("expected toggle to suspend, got %v", e.State())
+	}
+	e.Resume()
+	e.Resume()
+	if e.State() != Running {
+		t.Errorf("expected resume to run, got %v", e.State())
+	}
+	e.Stop()
+	e.Toggle()
+	if e.State() != Stopped {
+		t.Errorf("expected a stopped engine to stay stopped, got %v", e.State())
+	}
+	for _, want := range []State{Suspended, Running, Stopped} {
+		if change := <-e.States(); change.To != want {
+			t.Errorf("want change to %v, got %v", want, change.To)
+		}
+	}
+}
+
+func TestNewEngineErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "test_dict.json"), []byte(`{"U": "you"}`), 0644); err != nil {
+		t.Fatalf("failed to write test dict: %v", err)
+	}
+
+	cases := []struct {
+		name  string
+		cfg   config.Config
+		stage string // expected StageError stage
+		key   string // expected ConfigError key
+		is    error
+	}{
+		{
+			name:  "Missing Dictionaries",
+			cfg:   config.Config{Dictionaries: filepath.Join(dir, "missing"), Machine: "replay", ReplayFile: "strokes.txt", Dev: true},
+			stage: "dictionary",
+			is:    fs.ErrNotExist,
+		},
+		{
+			name: "Unknown Machine",
+			cfg:  config.Config{Dictionaries: dir, Machine: "qwerty", Dev: true},
+			key:  "machine",
+			is:   machine.ErrUnknownMachine,
+		},
+		{
+			name:  "Replay Without File",
+			cfg:   config.Config{Dictionaries: dir, Machine: "replay", Dev: true},
+			stage: "machine",
+		},
+		{
+			name: "Bad Custom Keys",
+			cfg:  config.Config{Dictionaries: dir, Machine: "geminipr", Dev: true, CustomKeys: map[string]string{"S1-": "Q-"}},
+			key:  "custom_keys",
+		},
+		{
+			name: "Bad Key Binding",
+			cfg:  config.Config{Dictionaries: dir, Machine: "replay", ReplayFile: "strokes.txt", Dev: true, KeyBindings: map[string]string{"pwr": "{PLOVER:TOGGLE}"}},
+			key:  "key_bindings",
+		},
+		{
+			name: "No Output",
+			cfg:  config.Config{Dictionaries: dir, Machine: "replay", ReplayFile: "strokes.txt"},
+			key:  "dev",
+			is:   ErrNoOutput,
+		},
+		{
+			name: "Bad Undo Mode",
+			cfg:  config.Config{Dictionaries: dir, Machine: "replay", ReplayFile: "strokes.txt", Dev: true, UndoMode: "word"},
+			key:  "undo_mode",
+		},
+		{
+			name: "Bad Untranslate Mode",
+			cfg:  config.Config{Dictionaries: dir, Machine: "replay", ReplayFile: "strokes.txt", Dev: true, Untranslate: "drop"},
+			key:  "untranslate",
+		},
+		{
+			name: "Bad Space Mode",
+			cfg:  config.Config{Dictionaries: dir, Machine: "replay", ReplayFile: "strokes.txt", Dev: true, Space: "around"},
+			key:  "space",
+		},
+		{
+			name:  "Stroke Log",
+			cfg:   config.Config{Dictionaries: dir, Machine: "replay", ReplayFile: "strokes.txt", Dev: true, LogPath: filepath.Join(dir, "missing", "strokes.log")},
+			stage: "stroke log",
+			is:    fs.ErrNotExist,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := NewEngine(&tc.cfg)
+			if err == nil {
+				t.Fatalf("expected an error, got an engine")
+			}
+			if e != nil {
+				t.Errorf("expected no engine with the error")
+			}
+			var stageErr *StageError
+			if tc.stage != "" && (!errors.As(err, &stageErr) || stageErr.Stage != tc.stage) {
+				t.Errorf("expected a %q stage error, got %v", tc.stage, err)
+			}
+			var cfgErr *ConfigError
+			if tc.key != "" && (!errors.As(err, &cfgErr) || cfgErr.Key != tc.key) {
+				t.Errorf("expected a config error for %q, got %v", tc.key, err)
+			}
+			if tc.is != nil && !errors.Is(err, tc.is) {
+				t.Errorf("expected error to wrap %v, got %v", tc.is, err)
+			}
+		})
+	}
+}
+
+func TestRunMachineError(t *testing.T) {
+	e, m, _ := newTestEngine(t, testDict)
+	m.startErr = errors.New("no such port")
+	err := e.Run(context.Background())
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "machine" || !errors.Is(err, m.startErr) {
+		t.Errorf("expected a machine stage error, got %v", err)
+	}
+}
+
+func TestStopDrains(t *testing.T) {
+	e, m, rec := newTestEngine(t, testDict)
+	errs := make(chan error, 1)
+	go func() { errs <- e.Run(context.Background()) }()
+	m.send("U", "KOPL")
+	e.Stop()
+
+	// Stop only returns once everything captured has been typed.
+	if len(rec.got) != 2 {
+		t.Errorf("expected 2 outputs typed before Stop returned, got %d", len(rec.got))
+	}
+	if err := <-errs; err != nil {
+		t.Errorf("expected Run to return nil, got %v", err)
+	}
+	e.Stop() // stopping twice is harmless
+}
+
+func TestRunContext(t *testing.T) {
+	e, m, _ := newTestEngine(t, testDict)
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() { errs <- e.Run(ctx) }()
+	m.send("U")
+	cancel()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("expected Run to return nil, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Run did not return after its context was canceled")
+	}
+	if e.State() != Stopped {
+		t.Errorf("expected engine to be stopped, got %v", e.State())
+	}
+}
+
+func TestNoGoroutineLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 3; i++ {
+		e, m, _ := newTestEngine(t, testDict)
+		go e.Run(context.Background())
+		m.send("U", "PHROLG", "KOPL", "PHROLG")
+		e.Stop()
+	}
+
+	// The goroutine that called Run may still be on its way out.
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		buf := make([]byte, 1<<16)
+		t.Errorf("expected %d goroutines after Stop, got %d:\n%s", before, n, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestRemap(t *testing.T) {
+	e, _, _ := newTestEngine(t, testDict)
+	if err := e.Remap(map[string]string{"S1-": "#-"}); err == nil {
+		t.Errorf("expected an error remapping a machine without a layout")
+	}
+
+	m := machine.NewGeminiPrMachine("mock", 9600)
+	e, err := newEngine(&config.Config{}, &MockDictionary{testDict}, nil, 1, m, func(in chan output.Output) output.OutputService {
+		return &RecordingOutput{in: in, done: make(chan struct{})}
+	})
+	if err != nil {
+		t.Fatalf("failed to build engine: %v", err)
+	}
+	if err := e.Remap(map[string]string{"S1-": "#-"}); err != nil {
+		t.Fatalf("failed to remap: %v", err)
+	}
+	if got := m.Layout()["S1-"]; got != "#-" {
+		t.Errorf("expected S1- to write #-, got %q", got)
+	}
+	if err := e.Remap(map[string]string{"S1-": "Q-"}); err == nil {
+		t.Errorf("expected an error remapping to a key that is not steno")
+	}
+}
+
+func TestKeyBindings(t *testing.T) {
+	cfg := &config.Config{KeyBindings: map[string]string{"pwr": "PHROLG", "Fn+res1": "KOPL", "Fn": "-PL"}}
+	e, m, rec := newTestEngineConfig(t, cfg, testDict)
+	go e.Run(context.Background())
+	m.send("U")
+	m.sendExtra("pwr") // suspend
+	m.send("U")
+	m.sendExtra("pwr") // resume
+	m.sendExtra("Fn", "res1")
+	m.sendExtra("res2") // not bound
+	m.sendChord("KO", "Fn")
+	m.sendChord("U", "res2") // not bound, so dropped
+	e.Stop()
+
+	var got []string
+	for _, o := range rec.got {
+		got = append(got, o.Write)
+	}
+	if want := "[you  come  come  you ]"; fmt.Sprint(got) != want {
+		t.Errorf("want outputs %s, got %q", want, got)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	main, fn := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(main, "main.json"), []byte(`{"U": "you", "KOPL": "come"}`), 0644); err != nil {
+		t.Fatalf("failed to write test dict: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(fn, "fn.json"), []byte(`{"U": "unicorn"}`), 0644); err != nil {
+		t.Fatalf("failed to write test dict: %v", err)
+	}
+	cfg := &config.Config{Dictionaries: main, Layers: map[string]string{"Fn": fn}}
+	dict, layers, outlineCap, err := LoadDictionaries(cfg)
+	if err != nil {
+		t.Fatalf("failed to load dictionaries: %v", err)
+	}
+	m := NewFakeMachine()
+	rec := &RecordingOutput{done: make(chan struct{})}
+	e, err := newEngine(cfg, dict, layers, outlineCap, m, func(in chan output.Output) output.OutputService {
+		rec.in = in
+		return rec
+	})
+	if err != nil {
+		t.Fatalf("failed to build engine: %v", err)
+	}
+	go e.Run(context.Background())
+	m.send("U")
+	m.sendChord("U", "Fn")
+	m.sendChord("KOPL", "Fn") // not in the layer
+	m.sendExtra("Fn")         // a layer key alone writes nothing
+	e.Stop()
+
+	var got []string
+	for _, o := range rec.got {
+		got = append(got, o.Write)
+	}
+	if want := "[you  unicorn  come ]"; fmt.Sprint(got) != want {
+		t.Errorf("want outputs %s, got %q", want, got)
+	}
+
+	cfg.Layers["Fn"] = filepath.Join(fn, "missing")
+	_, _, _, err = LoadDictionaries(cfg)
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) || cfgErr.Key != "layers" {
+		t.Errorf("expected a layers config error, got %v", err)
+	}
+}
+
+// opened receives every machine the "fake" driver builds, in order.
+var opened = make(chan *FakeMachine, 8)
+
+func init() {
+	machine.Register(machine.Driver{
+		Name:        "fake",
+		Description: "machine the tests send strokes from",
+		New: func(s machine.Settings) (machine.Machine, error) {
+			m := NewFakeMachine()
+			if s.Port == "missing" {
+				m.startErr = errors.New("no such port")
+			}
+			opened <- m
+			return m, nil
+		},
+	})
+}
+
+func TestReload(t *testing.T) {
+	short, long := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(long, "test_dict.json"), []byte(`{"KOPL": "come", "KOPL/PHRAOET": "complete"}`), 0644); err != nil {
+		t.Fatalf("failed to write test dict: %v", err)
+	}
+	cfg := &config.Config{Machine: "fake", Port: "one", Dictionaries: short}
+	e, first, rec := newTestEngineConfig(t, cfg, map[string]string{"KOPL": "come"})
+	go e.Run(context.Background())
+	first.send("KOPL")
+
+	// A new port reopens the machine, and the new dictionaries still see
+	// the stroke written before the reload.
+	err := e.Reload(&config.Config{Machine: "fake", Port: "two", Dictionaries: long, KeyBindings: map[string]string{"pwr": "PHRAOET"}, UndoMode: "translation"})
+	if err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	second, _ := <-opened, <-opened // the new machine, then the fallback
+	if !first.stopped {
+		t.Errorf("expected the old machine to be stopped")
+	}
+	second.sendExtra("pwr")
+
+	// A machine that will not open leaves the old settings running.
+	err = e.Reload(&config.Config{Machine: "fake", Port: "missing", Dictionaries: long})
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != "machine" {
+		t.Errorf("expected a machine stage error, got %v", err)
+	}
+	<-opened
+	fallback := <-opened
+	fallback.send("KOPL")
+	if got := e.config(); got.Port != "two" || got.UndoMode != "" {
+		t.Errorf("expected port two and no undo mode, got %q and %q", got.Port, got.UndoMode)
+	}
+
+	// Reloading the same folder picks up edits to its files.
+	if err := os.WriteFile(filepath.Join(long, "test_dict.json"), []byte(`{"KOPL": "come", "TKPWO": "go"}`), 0644); err != nil {
+		t.Fatalf("failed to write test dict: %v", err)
+	}
+	if err := e.Reload(&config.Config{Machine: "fake", Port: "two", Dictionaries: long}); err != nil {
+		t.Fatalf("failed to reload: %v", err)
+	}
+	fallback.send("TKPWO")
+	e.Stop()
+
+	var got []string
+	for _, o := range rec.got {
+		got = append(got, o.Undo+">"+o.Write)
+	}
+	if want := "[>come  come >complete  >come  >go ]"; fmt.Sprint(got) != want {
+		t.Errorf("want outputs %s, got %q", want, got)
+	}
+}
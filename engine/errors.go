@@ -0,0 +1,48 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sten/machine"
+)
+
+var (
+	// ErrUnknownMachine is returned for a machine type sten has no driver for.
+	ErrUnknownMachine = machine.ErrUnknownMachine
+	// ErrNoOutput is returned when the config asks for an output that is
+	// not implemented yet. Only dev output exists for now.
+	ErrNoOutput = errors.New("non-dev mode output not implemented")
+)
+
+// ConfigError reports a config value the engine cannot use.
+type ConfigError struct {
+	Key string // JSON name of the config field
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("config %q: %v", e.Key, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// StageError reports a part of the pipeline that failed to start or run,
+// such as the dictionary, the machine or the stroke log.
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Stage, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package engine
+
+import (
+	"context"
+	"sync"
+)
+
+// group runs the stages of the pipeline, like errgroup: the first stage to
+// fail cancels the context the others watch, and wait returns its error once
+// every stage has returned.
+type group struct {
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+	once   sync.Once
+	err    error
+}
+
+func newGroup(ctx context.Context) (*group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &group{cancel: cancel}, ctx
+}
+
+// run starts fn in its own goroutine. An error it returns is reported as a
+// *StageError for stage.
+func (g *group) run(stage string, fn func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := fn(); err != nil {
+			g.once.Do(func() {
+				g.err = &StageError{Stage: stage, Err: err}
+				g.cancel()
+			})
+		}
+	}()
+}
+
+// wait blocks until every stage has returned.
+func (g *group) wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
@@ -0,0 +1,218 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"maps"
+	"sort"
+	"sten/config"
+	"sten/machine"
+	"sten/stroke"
+)
+
+// swap is a machine Reload hands to a running engine. If next cannot be
+// opened, fallback, built from the old settings, is opened instead so the
+// writer is not left without a machine.
+type swap struct {
+	next     machine.Machine
+	fallback machine.Machine
+	result   chan error // whether next was opened
+}
+
+// config returns the config the engine runs with.
+func (e *Engine) config() *config.Config {
+	e.cfgMu.Lock()
+	defer e.cfgMu.Unlock()
+	return e.cfg
+}
+
+func (e *Engine) currentMachine() machine.Machine {
+	e.cfgMu.Lock()
+	defer e.cfgMu.Unlock()
+	return e.machine
+}
+
+// capture feeds strokes from the machine into the pipeline until ctx is done
+// or the machine runs out, changing machines when Reload swaps one in.
+func (e *Engine) capture(ctx context.Context) error {
+	defer close(e.captured)
+	m := e.currentMachine()
+	if err := m.StartCapture(); err != nil {
+		return err
+	}
+	in := m.Strokes()
+	for {
+		select {
+		case c, ok := <-in:
+			if !ok {
+				m.StopCapture()
+				return nil
+			}
+			e.captured <- c
+		case <-ctx.Done():
+			e.closeMachine(m, in)
+			return nil
+		case sw := <-e.swaps:
+			e.closeMachine(m, in)
+			m = sw.next
+			err := m.StartCapture()
+			sw.result <- err
+			if err != nil {
+				m = sw.fallback
+				if err := m.StartCapture(); err != nil {
+					return err
+				}
+			}
+			e.cfgMu.Lock()
+			e.machine = m
+			e.cfgMu.Unlock()
+			in = m.Strokes()
+		}
+	}
+}
+
+// closeMachine stops m and passes on the strokes it captured before it
+// stopped.
+func (e *Engine) closeMachine(m machine.Machine, in chan stroke.Capture) {
+	m.StopCapture()
+	for c := range in {
+		e.captured <- c
+	}
+}
+
+// Reload applies cfg in place of the config the engine runs with, touching
+// only what changed. The machine is reopened when its type, port, baud rate,
+// timeout or replay file change. The dictionaries are always read again, so
+// edits to their files apply too. Custom keys and key bindings are swapped
+// in. The translator keeps its history throughout, so undo and multi-stroke
+// entries carry on across a reload. Settings that need a restart are logged
+// and left as they were.
+//
+// Nothing is applied unless all of cfg can be. Errors are a *ConfigError or
+// a *StageError, as from NewEngine; if the new machine fails to open, the
+// old one is opened again and the error returned.
+func (e *Engine) Reload(cfg *config.Config) error {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+	old := e.config()
+	next := *cfg
+	keepRestartOnly(old, &next)
+
+	bindings, err := parseBindings(next.KeyBindings)
+	if err != nil {
+		return err
+	}
+	driver, err := machine.Lookup(next.Machine)
+	if err != nil {
+		return &ConfigError{Key: "machine", Err: err}
+	}
+
+	reopen := next.Machine != old.Machine || next.Port != old.Port || next.Baud != old.Baud ||
+		next.ReadTimeout != old.ReadTimeout || next.ReplayFile != old.ReplayFile || next.ReplaySpeed != old.ReplaySpeed
+	remap := !reopen && !maps.Equal(next.CustomKeys, old.CustomKeys)
+	var m, fallback machine.Machine
+	if reopen {
+		if m, err = newMachine(driver, &next); err != nil {
+			return err
+		}
+		oldDriver, err := machine.Lookup(old.Machine)
+		if err != nil {
+			return &ConfigError{Key: "machine", Err: err}
+		}
+		if fallback, err = newMachine(oldDriver, old); err != nil {
+			return err
+		}
+	}
+	if remap {
+		if _, ok := e.currentMachine().(machine.Remapper); !ok {
+			return &ConfigError{Key: "custom_keys", Err: fmt.Errorf("machine %q has no key layout to remap", next.Machine)}
+		}
+		if errs := driver.CheckKeys(next.CustomKeys); len(errs) > 0 {
+			return &ConfigError{Key: "custom_keys", Err: errs[0]}
+		}
+	}
+
+	dict, layers, outlineCap, err := LoadDictionaries(&next)
+	if err != nil {
+		return err
+	}
+
+	if remap {
+		if err := e.Remap(next.CustomKeys); err != nil {
+			return &ConfigError{Key: "custom_keys", Err: err}
+		}
+	}
+	if reopen {
+		if err := e.swapMachine(m, fallback); err != nil {
+			return &StageError{Stage: "machine", Err: err}
+		}
+	}
+	e.translator.SetDictionary(dict, outlineCap)
+	e.translator.SetLayers(layers)
+	e.cfgMu.Lock()
+	e.cfg = &next
+	e.bindings = bindings
+	e.dict, e.layers = dict, layers
+	e.cfgMu.Unlock()
+	return nil
+}
+
+// swapMachine replaces the machine, handing it to capture if the engine is
+// running.
+func (e *Engine) swapMachine(next, fallback machine.Machine) error {
+	e.runMu.Lock()
+	done := e.done
+	if done == nil {
+		// Not running yet, so Run will open the new machine.
+		e.cfgMu.Lock()
+		e.machine = next
+		e.cfgMu.Unlock()
+		e.runMu.Unlock()
+		return nil
+	}
+	e.runMu.Unlock()
+
+	sw := swap{next: next, fallback: fallback, result: make(chan error, 1)}
+	select {
+	case e.swaps <- sw:
+		return <-sw.result
+	case <-done:
+		// Stopped, so there is nothing to capture for.
+		return nil
+	}
+}
+
+// keepRestartOnly puts back in next the settings of old that a running
+// engine cannot change, logging the ones that differ.
+func keepRestartOnly(old, next *config.Config) {
+	changed := map[string]bool{
+		"dev":                next.Dev != old.Dev,
+		"undo_depth":         next.UndoDepth != old.UndoDepth,
+		"undo_mode":          next.UndoMode != old.UndoMode,
+		"untranslate":        next.Untranslate != old.Untranslate,
+		"untranslate_marker": next.Marker != old.Marker,
+		"space":              next.Space != old.Space,
+		"snapshot":           next.Snapshot != old.Snapshot,
+		"log_path":           next.LogPath != old.LogPath,
+		"log_max_size":       next.LogMaxSize != old.LogMaxSize,
+		"log_keep":           next.LogKeep != old.LogKeep,
+	}
+	var keys []string
+	for key, ok := range changed {
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		log.Printf("Config %q changed; restart sten to apply it", key)
+	}
+	next.Dev, next.UndoDepth, next.UndoMode = old.Dev, old.UndoDepth, old.UndoMode
+	next.Untranslate, next.Marker, next.Space = old.Untranslate, old.Marker, old.Space
+	next.Snapshot, next.LogPath, next.LogMaxSize, next.LogKeep = old.Snapshot, old.LogPath, old.LogMaxSize, old.LogKeep
+}
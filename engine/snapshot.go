@@ -0,0 +1,62 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sten/translator"
+	"time"
+)
+
+// How often a running engine writes its translator snapshot, so a crash
+// loses at most this much context.
+const snapshotInterval = 5 * time.Second
+
+// loadSnapshot restores the translator from path. A missing file is not an
+// error; it just means there is nothing to resume.
+func (e *Engine) loadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read snapshot: %w", err)
+	}
+	var snap translator.Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("could not decode snapshot: %w", err)
+	}
+	e.translator.Restore(snap)
+	e.snapshot = data
+	return nil
+}
+
+// saveSnapshot writes the translator state to path if it changed since the
+// last save. The file is replaced atomically so a crash can't truncate it.
+func (e *Engine) saveSnapshot(path string) error {
+	e.snapshotMu.Lock()
+	defer e.snapshotMu.Unlock()
+	data, err := json.Marshal(e.translator.Snapshot())
+	if err != nil {
+		return fmt.Errorf("could not encode snapshot: %w", err)
+	}
+	if bytes.Equal(data, e.snapshot) {
+		return nil
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("could not write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("could not write snapshot: %w", err)
+	}
+	e.snapshot = data
+	return nil
+}
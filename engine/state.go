@@ -0,0 +1,162 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package engine
+
+import (
+	"fmt"
+	"log"
+	"sten/dictionary"
+	"sten/stroke"
+	"strings"
+	"time"
+)
+
+// State is what the engine does with the strokes it receives.
+type State int
+
+const (
+	// Running translates strokes and types the result.
+	Running State = iota
+	// Suspended drops strokes, except for the ones that resume the engine.
+	Suspended
+	// Stopped no longer receives strokes.
+	Stopped
+)
+
+func (s State) String() string {
+	switch s {
+	case Running:
+		return "running"
+	case Suspended:
+		return "suspended"
+	case Stopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// StateChange reports the engine moving from one state to another.
+type StateChange struct {
+	From State
+	To   State
+	Time time.Time
+}
+
+// State returns the current state of the engine.
+func (e *Engine) State() State {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	return e.state
+}
+
+// States returns the channel state changes are sent on. Changes nobody
+// reads in time are dropped.
+func (e *Engine) States() chan StateChange {
+	return e.states
+}
+
+// Suspend stops typing output until Resume or Toggle.
+func (e *Engine) Suspend() {
+	e.setState(Suspended)
+}
+
+// Resume goes back to typing output after Suspend.
+func (e *Engine) Resume() {
+	e.setState(Running)
+}
+
+// Toggle suspends a running engine and resumes a suspended one.
+func (e *Engine) Toggle() {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	switch e.state {
+	case Running:
+		e.changeState(Suspended)
+	case Suspended:
+		e.changeState(Running)
+	}
+}
+
+func (e *Engine) setState(to State) {
+	e.stateMu.Lock()
+	defer e.stateMu.Unlock()
+	e.changeState(to)
+}
+
+// changeState moves to the new state and reports it. A stopped engine stays
+// stopped. The caller holds stateMu.
+func (e *Engine) changeState(to State) {
+	from := e.state
+	if from == to || from == Stopped {
+		return
+	}
+	e.state = to
+	select {
+	case e.states <- StateChange{From: from, To: to, Time: time.Now()}:
+	default:
+	}
+}
+
+// gate passes strokes on to the translator while the engine is running. It
+// acts on state commands itself, so a suspended engine still notices the
+// stroke that resumes it. Extra keys stand in for the stroke bound to them,
+// joining the chord when held with steno keys, and are passed on for the
+// translator to look the stroke up in their layer. Extra keys with neither
+// are dropped, and logged if steno keys were held with them.
+func (e *Engine) gate() {
+	defer close(e.gated)
+	for c := range e.strokes {
+		e.cfgMu.Lock()
+		bindings, layers, dict := e.bindings, e.layers, e.dict
+		e.cfgMu.Unlock()
+		if len(c.Extra) > 0 {
+			keys := strings.Join(c.Extra, "+")
+			bound, ok := bindings[keys]
+			_, layered := layers[keys]
+			switch {
+			case ok:
+				c.Stroke |= bound
+			case c.Stroke == 0:
+				continue
+			case !layered:
+				log.Printf("Extra keys %s have no binding or layer; writing %s without them", keys, c.Stroke.Steno())
+			}
+		}
+		entry, _ := dict.Lookup(c.Stroke.Outline())
+		switch entry {
+		case dictionary.CommandToggle:
+			e.Toggle()
+			continue
+		case dictionary.CommandSuspend:
+			e.Suspend()
+			continue
+		case dictionary.CommandResume:
+			e.Resume()
+			continue
+		}
+		if e.State() == Running {
+			e.gated <- c
+		}
+	}
+}
+
+// parseBindings reads key_bindings, which map extra keys to the steno keys
+// they write, alone or with the steno keys held with them. Keys pressed
+// together are joined with "+" in the order the machine reads them, as in
+// "Fn+pwr".
+func parseBindings(bindings map[string]string) (map[string]stroke.Stroke, error) {
+	parsed := make(map[string]stroke.Stroke, len(bindings))
+	for keys, steno := range bindings {
+		s := stroke.ParseSteno(steno)
+		// Steno that does not read back the same had keys out of order or
+		// characters that are not keys.
+		if s == 0 || strings.ReplaceAll(s.Steno(), "-", "") != strings.ReplaceAll(steno, "-", "") {
+			return nil, &ConfigError{Key: "key_bindings", Err: fmt.Errorf("%q is bound to %q, which is not a stroke", keys, steno)}
+		}
+		parsed[keys] = s
+	}
+	return parsed, nil
+}
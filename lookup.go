@@ -0,0 +1,91 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"sten/dictionary"
+	"sten/stroke"
+)
+
+// lookup prints the outlines that write a word, or with -steno the
+// translation of an outline.
+func lookup(args []string) int {
+	fs := flag.NewFlagSet("lookup", flag.ContinueOnError)
+	steno := fs.Bool("steno", false, "look up an outline instead of a word")
+	prefix := fs.Bool("prefix", false, "match everything starting with the word or outline")
+	fuzzy := fs.Bool("fuzzy", false, "match words a typo or two away")
+	limit := fs.Int("limit", 20, "most matches to print, 0 for all")
+	var opts options
+	opts.register(fs, false)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sten lookup [flags] <word>\n       sten lookup -steno [flags] <outline>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 || (*steno && *fuzzy) || (*prefix && *fuzzy) {
+		fs.Usage()
+		return exitUsage
+	}
+	query := strings.Join(fs.Args(), " ")
+	if *steno {
+		if err := stroke.CheckOutline(query); err != nil {
+			fmt.Fprintf(os.Stderr, "sten lookup: outline %q: %v\n", query, err)
+			return exitUsage
+		}
+	}
+
+	cfg, err := opts.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sten lookup: %v\n", err)
+		return exitConfig
+	}
+	dict, _, err := dictionary.LoadDictionaries(cfg.Dictionaries)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sten lookup: %v\n", err)
+		return exitConfig
+	}
+	s, ok := dict.(dictionary.Searcher)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "sten lookup: dictionary cannot be searched")
+		return exitFailure
+	}
+
+	var matches []dictionary.Match
+	switch {
+	case *steno && *prefix:
+		matches = s.SearchOutline(stroke.ParseOutline(query), *limit)
+	case *steno:
+		outline := stroke.ParseOutline(query)
+		if translation, ok := dict.Lookup(outline); ok {
+			matches = []dictionary.Match{{Translation: translation, Outlines: []stroke.Outline{outline}}}
+		}
+	case *prefix:
+		matches = s.Search(query, dictionary.SearchPrefix, *limit)
+	case *fuzzy:
+		matches = s.Search(query, dictionary.SearchFuzzy, *limit)
+	default:
+		matches = s.Search(query, dictionary.SearchExact, *limit)
+	}
+	if len(matches) == 0 {
+		fmt.Fprintf(os.Stderr, "sten lookup: no match for %q\n", query)
+		return exitFailure
+	}
+
+	for _, m := range matches {
+		outlines := make([]string, len(m.Outlines))
+		for i, o := range m.Outlines {
+			outlines[i] = o.String()
+		}
+		fmt.Printf("%s\t%s\n", m.Translation, strings.Join(outlines, ", "))
+	}
+	return exitOK
+}
@@ -9,7 +9,9 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"sten/stroke"
+	"sync"
 	"time"
 
 	"github.com/tarm/serial"
@@ -51,7 +53,8 @@ var keyChart = GeminiBoard{
 	{"#7", "#8", "#9", "#A", "#B", "#C", "-Z"},
 }
 
-// Can Be overridden to customize layouts
+// GeminiDefaults is the standard layout. Machines copy it and apply their
+// own overrides, so it is never modified.
 var GeminiDefaults = map[string]string{
 	"#1":  "#-",
 	"#2":  "#-",
@@ -91,41 +94,120 @@ var GeminiDefaults = map[string]string{
 	"-S":  "-S",
 	"-D":  "-D",
 	"-Z":  "-Z",
-	// Optionally map Fn, pwr, res1, etc., as needed.
+	// Keys outside the steno layout arrive as Capture.Extra.
+	"Fn":   "Fn",
+	"pwr":  "pwr",
+	"res1": "res1",
+	"res2": "res2",
 }
 
 // GeminiPrMachine represents a Gemini PR stenotype machine.
 type GeminiPrMachine struct {
-	portName   string
-	baudRate   int
-	port       SerialPort
-	strokeChan chan stroke.Stroke
+	portName    string
+	baudRate    int
+	readTimeout time.Duration
+	port        SerialPort
+	strokeChan  chan stroke.Capture
+	finite      bool // stop at EOF instead of waiting for the next stroke
+
+	layoutMu sync.Mutex // guards layout between readLoop and Remap
+	layout   map[string]string
+}
+
+func init() {
+	Register(Driver{
+		Name:        "geminipr",
+		Description: "stenotype speaking the Gemini PR protocol over serial",
+		Schema: []Setting{
+			{Key: "serial_port", Description: "serial device, such as /dev/ttyACM0", Required: true, Path: true},
+			{Key: "baud_rate", Description: "serial speed"},
+			{Key: "timeout", Description: "milliseconds each serial read waits, 2000 if unset"},
+			{Key: "custom_keys", Description: "overrides of the key layout"},
+		},
+		Layout: GeminiDefaults,
+		New: func(s Settings) (Machine, error) {
+			m := NewGeminiPrMachine(s.Port, s.Baud)
+			if s.Reader != nil {
+				m = NewGeminiPrReader(s.Reader)
+			}
+			if s.ReadTimeout > 0 {
+				m.readTimeout = s.ReadTimeout
+			}
+			if err := m.Remap(s.Keys); err != nil {
+				return nil, err
+			}
+			return m, nil
+		},
+	})
 }
 
+// DefaultReadTimeout is how long a serial read waits when the config sets
+// no timeout.
+const DefaultReadTimeout = 2 * time.Second
+
 // NewGeminiPrMachine creates a new Gemini PR machine instance.
 func NewGeminiPrMachine(portName string, baudRate int) *GeminiPrMachine {
 	return &GeminiPrMachine{
-		portName:   portName,
-		baudRate:   baudRate,
-		strokeChan: make(chan stroke.Stroke, 64),
+		portName:    portName,
+		baudRate:    baudRate,
+		readTimeout: DefaultReadTimeout,
+		strokeChan:  make(chan stroke.Capture, 64),
+		layout:      GeminiDefaults,
+	}
+}
+
+// Remap replaces the custom keys of the layout: it becomes GeminiDefaults
+// with keys laid over it. Every key must be a Gemini PR key and every value
+// a steno key, or "" to ignore the key. It is safe to call while capturing.
+func (m *GeminiPrMachine) Remap(keys map[string]string) error {
+	layout, err := overlay(GeminiDefaults, keys)
+	if err != nil {
+		return err
 	}
+	m.layoutMu.Lock()
+	m.layout = layout
+	m.layoutMu.Unlock()
+	return nil
+}
+
+// Layout returns a copy of the layout in use.
+func (m *GeminiPrMachine) Layout() map[string]string {
+	m.layoutMu.Lock()
+	defer m.layoutMu.Unlock()
+	return maps.Clone(m.layout)
+}
+
+// NewGeminiPrReader creates a machine that decodes Gemini PR packets read
+// from r, such as a saved capture, and stops at the end of it.
+func NewGeminiPrReader(r io.Reader) *GeminiPrMachine {
+	m := NewGeminiPrMachine("", 0)
+	m.port = readerPort{r}
+	m.finite = true
+	return m
 }
 
+type readerPort struct {
+	io.Reader
+}
+
+func (readerPort) Close() error { return nil }
+
 // StartCapture opens the serial port and starts reading strokes.
 func (m *GeminiPrMachine) StartCapture() error {
 	if m.port == nil {
 		c := &serial.Config{
 			Name:        m.portName,
 			Baud:        m.baudRate,
-			ReadTimeout: time.Second * 2,
+			ReadTimeout: m.readTimeout,
 		}
 		port, err := serial.OpenPort(c)
 		if err != nil {
+			close(m.strokeChan)
 			return fmt.Errorf("failed to open serial port: %w", err)
 		}
 		m.port = port
 	}
-	go m.readLoop()
+	go m.readLoop(m.port)
 	return nil
 }
 
@@ -137,24 +219,37 @@ func (m *GeminiPrMachine) StopCapture() {
 	}
 }
 
-// reads packets and sends output via the callback
-func (m *GeminiPrMachine) readLoop() {
+// reads packets and sends output via the callback. It keeps its own port,
+// since StopCapture clears m.port while a read may be in progress.
+func (m *GeminiPrMachine) readLoop(port SerialPort) {
 	defer close(m.strokeChan)
 
 	packet := StrokePacket{}
 	for {
-		_, err := m.port.Read(packet[:])
+		var err error
+		if m.finite {
+			_, err = io.ReadFull(port, packet[:])
+		} else {
+			_, err = port.Read(packet[:])
+		}
 		if err != nil {
 			// Only print unexpected errors
 			if err == io.EOF {
+				if m.finite {
+					break
+				}
 				continue
 			}
 			log.Printf("serial read error: %v", err)
 			break
 		}
-		stroke, err := packet.toStroke()
+		at := time.Now()
+		m.layoutMu.Lock()
+		layout := m.layout
+		m.layoutMu.Unlock()
+		s, extra, err := packet.toStroke(layout)
 		if err == nil {
-			m.strokeChan <- stroke
+			m.strokeChan <- stroke.Capture{Stroke: s, Time: at, Raw: append([]byte(nil), packet[:]...), Extra: extra}
 		}
 	}
 }
@@ -172,25 +267,32 @@ func (p StrokePacket) isValid() bool {
 	return true
 }
 
-func (m *GeminiPrMachine) Strokes() chan stroke.Stroke {
+func (m *GeminiPrMachine) Strokes() chan stroke.Capture {
 	return m.strokeChan
 }
 
-func (packet *StrokePacket) toStroke() (stroke.Stroke, error) {
+// toStroke decodes the steno keys of a packet, and the names of the other
+// keys held with them.
+func (packet *StrokePacket) toStroke(layout map[string]string) (stroke.Stroke, []string, error) {
 	if !packet.isValid() {
-		return 0, errors.New("Invalid Stroke Packet")
+		return 0, nil, errors.New("Invalid Stroke Packet")
 	}
-	var keys []string
+	var keys, extra []string
 	for row, b := range packet {
 		for bit := 1; bit <= 7; bit++ {
 			mask := byte(0x80 >> bit)
 			if b&mask != 0 {
-				if key, ok := GeminiDefaults[keyChart[row][bit-1]]; ok {
+				key, ok := layout[keyChart[row][bit-1]]
+				switch {
+				case !ok || key == "":
+				case stroke.IsKey(key):
 					keys = append(keys, key)
+				default:
+					extra = append(extra, key)
 				}
 			}
 		}
 	}
 	stenoKeys := stroke.JoinKeys(keys)
-	return stroke.ParseSteno(stenoKeys), nil
+	return stroke.ParseSteno(stenoKeys), extra, nil
 }
@@ -5,6 +5,8 @@
 package machine
 
 import (
+	"bytes"
+	"fmt"
 	"io"
 	"testing"
 )
@@ -104,7 +106,7 @@ var geminiBits = map[string][2]int{
 
 func TestProcessPacket_InvalidFirstByte(t *testing.T) {
 	packet := StrokePacket{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
-	_, err := packet.toStroke()
+	_, _, err := packet.toStroke(GeminiDefaults)
 	if err == nil {
 		t.Errorf("Packet parsed incorrectly")
 	}
@@ -112,7 +114,7 @@ func TestProcessPacket_InvalidFirstByte(t *testing.T) {
 
 func TestProcessPacket_InvalidOtherByte(t *testing.T) {
 	packet := StrokePacket{0x80, 0x80, 0x00, 0x00, 0x00, 0x00}
-	_, err := packet.toStroke()
+	_, _, err := packet.toStroke(GeminiDefaults)
 	if err == nil {
 		t.Errorf("Packet parsed incorrectly")
 	}
@@ -195,8 +197,18 @@ func TestGeminiMachine(t *testing.T) {
 			go func() { machine.StartCapture(); close(done) }()
 
 			var output []string
-			for stroke := range machine.Strokes() {
-				output = append(output, stroke.Steno())
+			for i := 0; ; i++ {
+				c, ok := <-machine.Strokes()
+				if !ok {
+					break
+				}
+				output = append(output, c.Stroke.Steno())
+				if c.Time.IsZero() {
+					t.Errorf("at %d: stroke has no capture time", i)
+				}
+				if i < len(tc.input) && !bytes.Equal(c.Raw, tc.input[i][:]) {
+					t.Errorf("at %d: want raw packet %v, got %v", i, tc.input[i], c.Raw)
+				}
 			}
 			machine.StopCapture()
 			<-done
@@ -215,3 +227,127 @@ func TestGeminiMachine(t *testing.T) {
 		})
 	}
 }
+
+func TestRemap(t *testing.T) {
+	cases := []struct {
+		name     string
+		keys     map[string]string
+		packet   StrokePacket
+		expected string
+		wantErr  bool
+	}{
+		{
+			name:     "Defaults",
+			packet:   MakeGeminiPacket("S1-", "-T"),
+			expected: "S-T",
+		},
+		{
+			name:     "Number Key",
+			keys:     map[string]string{"S1-": "#-"},
+			packet:   MakeGeminiPacket("S1-", "-T"),
+			expected: "#-T",
+		},
+		{
+			name:     "Ignored Key",
+			keys:     map[string]string{"S1-": ""},
+			packet:   MakeGeminiPacket("S1-", "-T"),
+			expected: "-T",
+		},
+		{
+			name:    "Not A Machine Key",
+			keys:    map[string]string{"Q": "S-"},
+			wantErr: true,
+		},
+		{
+			name:    "Not A Steno Key",
+			keys:    map[string]string{"S1-": "Q-"},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewGeminiPrMachine("mock", 9600)
+			err := m.Remap(tc.keys)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error for %v", tc.keys)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to remap: %v", err)
+			}
+			s, _, err := tc.packet.toStroke(m.Layout())
+			if err != nil {
+				t.Fatalf("failed to decode packet: %v", err)
+			}
+			if s.Steno() != tc.expected {
+				t.Errorf("want %q, got %q", tc.expected, s.Steno())
+			}
+		})
+	}
+
+	// Remapping one machine leaves the defaults and other machines alone.
+	a, b := NewGeminiPrMachine("a", 9600), NewGeminiPrMachine("b", 9600)
+	if err := a.Remap(map[string]string{"S1-": "#-"}); err != nil {
+		t.Fatalf("failed to remap: %v", err)
+	}
+	if GeminiDefaults["S1-"] != "S-" || b.Layout()["S1-"] != "S-" {
+		t.Errorf("remap leaked out of the machine it was made on")
+	}
+}
+
+func TestExtraKeys(t *testing.T) {
+	cases := []struct {
+		name     string
+		keys     map[string]string
+		packet   StrokePacket
+		expected string
+		extra    []string
+	}{
+		{
+			name:     "Held With Steno",
+			packet:   MakeGeminiPacket("Fn", "S1-", "pwr"),
+			expected: "S",
+			extra:    []string{"Fn", "pwr"},
+		},
+		{
+			name:   "Alone",
+			packet: MakeGeminiPacket("res1", "res2"),
+			extra:  []string{"res1", "res2"},
+		},
+		{
+			name:     "Remapped To Steno",
+			keys:     map[string]string{"res1": "*"},
+			packet:   MakeGeminiPacket("res1", "-T"),
+			expected: "*T",
+		},
+		{
+			name:     "Steno Remapped To Extra",
+			keys:     map[string]string{"S2-": "Fn"},
+			packet:   MakeGeminiPacket("S2-", "-T"),
+			expected: "-T",
+			extra:    []string{"Fn"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := NewGeminiPrMachine("mock", 9600)
+			if err := m.Remap(tc.keys); err != nil {
+				t.Fatalf("failed to remap: %v", err)
+			}
+			s, extra, err := tc.packet.toStroke(m.Layout())
+			if err != nil {
+				t.Fatalf("failed to decode packet: %v", err)
+			}
+			if s.Steno() != tc.expected {
+				t.Errorf("want steno %q, got %q", tc.expected, s.Steno())
+			}
+			if fmt.Sprint(extra) != fmt.Sprint(tc.extra) {
+				t.Errorf("want extra keys %v, got %v", tc.extra, extra)
+			}
+		})
+	}
+}
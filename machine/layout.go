@@ -0,0 +1,61 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"sten/stroke"
+)
+
+// KeyError reports a custom key that a layout cannot take.
+type KeyError struct {
+	Key string // the machine key, as named in custom_keys
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("custom key %q %v", e.Key, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// overlay returns a copy of defaults with keys laid over it. Only keys that
+// defaults already has can be remapped, and only to steno keys, "" or the
+// extra keys that defaults binds.
+func overlay(defaults, keys map[string]string) (map[string]string, error) {
+	layout := maps.Clone(defaults)
+	extra := make(map[string]bool)
+	for _, v := range defaults {
+		if !stroke.IsKey(v) {
+			extra[v] = true
+		}
+	}
+	// Sorted so the same bad config always reports the same key.
+	for _, k := range sortedKeys(keys) {
+		v := keys[k]
+		if _, ok := defaults[k]; !ok {
+			return nil, &KeyError{Key: k, Err: errors.New("is not a key on this machine")}
+		}
+		if v != "" && !stroke.IsKey(v) && !extra[v] {
+			return nil, &KeyError{Key: k, Err: fmt.Errorf("maps to %q, which is not a steno key", v)}
+		}
+		layout[k] = v
+	}
+	return layout, nil
+}
+
+func sortedKeys(keys map[string]string) []string {
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
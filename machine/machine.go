@@ -6,8 +6,10 @@ package machine
 
 import "sten/stroke"
 
+// Machine captures strokes from a steno machine. Strokes is closed once
+// capture ends, whether StopCapture ended it or StartCapture failed.
 type Machine interface {
 	StartCapture() error
 	StopCapture()
-	Strokes() chan stroke.Stroke
+	Strokes() chan stroke.Capture
 }
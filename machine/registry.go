@@ -0,0 +1,122 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownMachine is returned for a machine name nothing registered.
+var ErrUnknownMachine = errors.New("unknown machine type")
+
+// Settings are the config values a machine is built from. Each driver reads
+// the ones its Schema lists.
+type Settings struct {
+	Port  string  // serial_port
+	Baud  int     // baud_rate
+	File  string  // replay_file
+	Speed float64 // replay_speed
+	// ReadTimeout bounds each serial read, from timeout. Zero means the
+	// driver's default.
+	ReadTimeout time.Duration
+	// Keys override the driver's default layout, from custom_keys.
+	Keys map[string]string
+	// Reader, if set, is read in place of the port or replay file, and the
+	// machine stops at the end of it.
+	Reader io.Reader
+}
+
+// Setting describes one config key a driver reads.
+type Setting struct {
+	Key         string
+	Description string
+	Required    bool // the machine cannot work without it
+	Path        bool // the value names a file or device that should exist
+}
+
+// Driver describes a kind of machine that can be named in the config.
+type Driver struct {
+	Name        string
+	Description string
+	Schema      []Setting
+	// Layout maps the machine's physical keys to steno keys by default.
+	// It is nil for machines that produce steno directly, and must not be
+	// modified.
+	Layout map[string]string
+	New    func(Settings) (Machine, error)
+}
+
+var (
+	driversMu sync.Mutex
+	drivers   = make(map[string]Driver)
+)
+
+// Register makes a driver available by name. It panics if the name is
+// taken, since that can only be a programming error.
+func Register(d Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if _, dup := drivers[d.Name]; dup {
+		panic("machine: Register called twice for " + d.Name)
+	}
+	drivers[d.Name] = d
+}
+
+// CheckKeys reports every custom key the driver's layout cannot take, in
+// key order.
+func (d Driver) CheckKeys(keys map[string]string) []*KeyError {
+	var errs []*KeyError
+	for _, k := range sortedKeys(keys) {
+		if d.Layout == nil {
+			errs = append(errs, &KeyError{Key: k, Err: fmt.Errorf("cannot be set: machine %q has no key layout", d.Name)})
+			continue
+		}
+		var ke *KeyError
+		if _, err := overlay(d.Layout, map[string]string{k: keys[k]}); errors.As(err, &ke) {
+			errs = append(errs, ke)
+		}
+	}
+	return errs
+}
+
+// Remapper is implemented by machines whose key layout can change while
+// they capture.
+type Remapper interface {
+	Remap(keys map[string]string) error
+}
+
+// Lookup returns the driver registered as name. The error for an unknown
+// name wraps ErrUnknownMachine and lists the names that are available.
+func Lookup(name string) (Driver, error) {
+	driversMu.Lock()
+	d, ok := drivers[name]
+	driversMu.Unlock()
+	if !ok {
+		var names []string
+		for _, d := range Drivers() {
+			names = append(names, d.Name)
+		}
+		return Driver{}, fmt.Errorf("%w %q (available: %s)", ErrUnknownMachine, name, strings.Join(names, ", "))
+	}
+	return d, nil
+}
+
+// Drivers returns every registered driver, sorted by name.
+func Drivers() []Driver {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	list := make([]Driver, 0, len(drivers))
+	for _, d := range drivers {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package machine
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	cases := []struct {
+		name   string
+		layout bool
+	}{
+		{"geminipr", true},
+		{"replay", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d, err := Lookup(tc.name)
+			if err != nil {
+				t.Fatalf("expected %q to be registered: %v", tc.name, err)
+			}
+			if (d.Layout != nil) != tc.layout {
+				t.Errorf("expected layout %v, got %v", tc.layout, d.Layout != nil)
+			}
+			if len(d.Schema) == 0 || d.New == nil {
+				t.Errorf("expected a schema and a constructor, got %+v", d)
+			}
+		})
+	}
+
+	_, err := Lookup("qwerty")
+	if !errors.Is(err, ErrUnknownMachine) {
+		t.Errorf("expected ErrUnknownMachine, got %v", err)
+	}
+	if err == nil || !strings.Contains(err.Error(), "geminipr, replay") {
+		t.Errorf("expected the error to list the machines, got %v", err)
+	}
+
+	gemini, _ := Lookup("geminipr")
+	errs := gemini.CheckKeys(map[string]string{"S1-": "#-", "S2-": "Q-", "res9": "S-"})
+	var keys []string
+	for _, err := range errs {
+		keys = append(keys, err.Key)
+	}
+	if strings.Join(keys, " ") != "S2- res9" {
+		t.Errorf("expected errors for S2- and res9, got %v", errs)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering a name twice to panic")
+		}
+	}()
+	Register(Driver{Name: "replay"})
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package machine
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sten/stroke"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplayMachine plays strokes back from a file instead of a stenotype, for
+// reproducible tests and demos. The file is either plain steno, one outline
+// per line such as "KOPL/PHRAOET", or a stroke log as written by strokelog,
+// whose output records are skipped.
+//
+// Strokes from a stroke log can keep their original spacing in time, scaled
+// by speed: 1 plays in real time, 2 twice as fast. A speed of 0, or plain
+// steno, plays every stroke at once.
+type ReplayMachine struct {
+	open       func() (io.ReadCloser, error)
+	speed      float64
+	strokeChan chan stroke.Capture
+	stop       chan struct{}
+	stopOnce   sync.Once
+}
+
+func init() {
+	Register(Driver{
+		Name:        "replay",
+		Description: "plays back a steno file or stroke log",
+		Schema: []Setting{
+			{Key: "replay_file", Description: "file of steno outlines or a stroke log", Required: true, Path: true},
+			{Key: "replay_speed", Description: "1 keeps the logged timing, 2 plays twice as fast, 0 plays at once"},
+		},
+		New: func(s Settings) (Machine, error) {
+			if s.Reader != nil {
+				return NewReplayReader(s.Reader, s.Speed), nil
+			}
+			if s.File == "" {
+				return nil, errors.New("replay_file is not set")
+			}
+			return NewReplayMachine(s.File, s.Speed), nil
+		},
+	})
+}
+
+// NewReplayMachine creates a machine that replays the file at path.
+func NewReplayMachine(path string, speed float64) *ReplayMachine {
+	return newReplayMachine(func() (io.ReadCloser, error) { return os.Open(path) }, speed)
+}
+
+// NewReplayReader creates a machine that replays strokes read from r.
+func NewReplayReader(r io.Reader, speed float64) *ReplayMachine {
+	return newReplayMachine(func() (io.ReadCloser, error) { return io.NopCloser(r), nil }, speed)
+}
+
+func newReplayMachine(open func() (io.ReadCloser, error), speed float64) *ReplayMachine {
+	return &ReplayMachine{
+		open:       open,
+		speed:      speed,
+		strokeChan: make(chan stroke.Capture, 64),
+		stop:       make(chan struct{}),
+	}
+}
+
+// StartCapture opens the file and starts playing it back.
+func (m *ReplayMachine) StartCapture() error {
+	r, err := m.open()
+	if err != nil {
+		close(m.strokeChan)
+		return fmt.Errorf("failed to open replay: %w", err)
+	}
+	go m.playLoop(r)
+	return nil
+}
+
+// StopCapture stops playback early.
+func (m *ReplayMachine) StopCapture() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+func (m *ReplayMachine) Strokes() chan stroke.Capture {
+	return m.strokeChan
+}
+
+func (m *ReplayMachine) playLoop(r io.ReadCloser) {
+	defer close(m.strokeChan)
+	defer r.Close()
+
+	var last time.Time
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		recorded, err := parseReplayLine(scanner.Text())
+		if err != nil {
+			log.Printf("replay line %d: %v", line, err)
+			continue
+		}
+		for _, c := range recorded {
+			if m.speed > 0 && !c.Time.IsZero() && !last.IsZero() {
+				delay := time.Duration(float64(c.Time.Sub(last)) / m.speed)
+				select {
+				case <-time.After(delay):
+				case <-m.stop:
+					return
+				}
+			}
+			if !c.Time.IsZero() {
+				last = c.Time
+			}
+			c.Time = time.Now()
+			select {
+			case m.strokeChan <- c:
+			case <-m.stop:
+				return
+			}
+		}
+	}
+}
+
+// parseReplayLine returns the strokes on one line, with their original
+// capture time if the line came from a stroke log.
+func parseReplayLine(line string) ([]stroke.Capture, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) >= 3 {
+		if fields[1] != "stroke" {
+			return nil, nil
+		}
+		at, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("bad time: %w", err)
+		}
+		// A stroke of only extra keys has no steno.
+		if fields[2] != "" {
+			if err := stroke.CheckSteno(fields[2]); err != nil {
+				return nil, err
+			}
+		}
+		c := stroke.Capture{Stroke: stroke.ParseSteno(fields[2]), Time: at}
+		if len(fields) > 3 && fields[3] != "" {
+			if c.Raw, err = hex.DecodeString(fields[3]); err != nil {
+				return nil, fmt.Errorf("bad raw packet: %w", err)
+			}
+		}
+		if len(fields) > 4 && fields[4] != "" {
+			c.Extra = strings.Split(fields[4], "+")
+		}
+		return []stroke.Capture{c}, nil
+	}
+
+	steno := strings.TrimSpace(line)
+	if steno == "" {
+		return nil, nil
+	}
+	if err := stroke.CheckOutline(steno); err != nil {
+		return nil, err
+	}
+	var recorded []stroke.Capture
+	for _, s := range stroke.ParseOutline(steno) {
+		recorded = append(recorded, stroke.Capture{Stroke: s})
+	}
+	return recorded, nil
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package machine
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReplayMachine(t *testing.T) {
+	cases := []struct {
+		name     string
+		input    string
+		speed    float64
+		expected []string
+		raw      []byte
+		extra    [][]string
+		minTime  time.Duration
+	}{
+		{
+			name:     "Steno",
+			input:    "STKPHEPL/PWER\n\n-PLT\n",
+			expected: []string{"STKPHEPL", "PWER", "-PLT"},
+		},
+		{
+			name: "Stroke Log",
+			input: "2025-01-02T03:04:05Z\tstroke\tKOPL\t8001\n" +
+				"2025-01-02T03:04:05Z\toutput\t\"\"\t\"come \"\n" +
+				"2025-01-02T03:04:06Z\tstroke\tPHRAOET\t\n",
+			speed:    20,
+			expected: []string{"KOPL", "PHRAOET"},
+			raw:      []byte{0x80, 0x01},
+			minTime:  50 * time.Millisecond,
+		},
+		{
+			name: "Stroke Log Extra Keys",
+			input: "2025-01-02T03:04:05Z\tstroke\t\tc000\tFn+pwr\n" +
+				"2025-01-02T03:04:05Z\tstroke\tKOPL\t8001\t\n" +
+				"2025-01-02T03:04:05Z\tstroke\tPHRAOET\t\n",
+			expected: []string{"", "KOPL", "PHRAOET"},
+			extra:    [][]string{{"Fn", "pwr"}, nil, nil},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			machine := NewReplayReader(strings.NewReader(tc.input), tc.speed)
+			start := time.Now()
+			if err := machine.StartCapture(); err != nil {
+				t.Fatalf("failed to start replay: %v", err)
+			}
+
+			var output []string
+			for i := 0; ; i++ {
+				c, ok := <-machine.Strokes()
+				if !ok {
+					break
+				}
+				output = append(output, c.Stroke.Steno())
+				if tc.extra != nil && !slices.Equal(c.Extra, tc.extra[i]) {
+					t.Errorf("at %d: want extra keys %v, got %v", i, tc.extra[i], c.Extra)
+				}
+				if i == 0 && tc.raw != nil && !bytes.Equal(c.Raw, tc.raw) {
+					t.Errorf("want raw packet %v, got %v", tc.raw, c.Raw)
+				}
+			}
+			if elapsed := time.Since(start); elapsed < tc.minTime {
+				t.Errorf("expected replay to take at least %v, took %v", tc.minTime, elapsed)
+			}
+
+			if len(output) != len(tc.expected) {
+				t.Fatalf("expected %d outputs, got %d", len(tc.expected), len(output))
+			}
+			for i, want := range tc.expected {
+				if output[i] != want {
+					t.Errorf("at %d: want %q, got %q", i, want, output[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReplayMachineStop(t *testing.T) {
+	input := "2025-01-02T03:04:05Z\tstroke\tKOPL\t\n" +
+		"2025-01-02T04:04:05Z\tstroke\tPHRAOET\t\n"
+	machine := NewReplayReader(strings.NewReader(input), 1)
+	if err := machine.StartCapture(); err != nil {
+		t.Fatalf("failed to start replay: %v", err)
+	}
+	<-machine.Strokes()
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			machine.StopCapture()
+		}()
+	}
+	wg.Wait()
+	if _, ok := <-machine.Strokes(); ok {
+		t.Errorf("expected no strokes after stopping")
+	}
+}
+
+func TestReplayMachineBadLines(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	input := "KOPL\nKOPQ\nOA/PWER\n2025-01-02T03:04:05Z\tstroke\tKOPLZ*\t\n-PLT\n"
+	machine := NewReplayReader(strings.NewReader(input), 0)
+	if err := machine.StartCapture(); err != nil {
+		t.Fatalf("failed to start replay: %v", err)
+	}
+	var output []string
+	for c := range machine.Strokes() {
+		output = append(output, c.Stroke.Steno())
+	}
+	if want := "[KOPL -PLT]"; fmt.Sprint(output) != want {
+		t.Errorf("want strokes %s, got %v", want, output)
+	}
+	for _, line := range []string{"replay line 2:", "replay line 3:", "replay line 4:"} {
+		if !strings.Contains(logged.String(), line) {
+			t.Errorf("expected %q to be logged, got:\n%s", line, logged.String())
+		}
+	}
+}
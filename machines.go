@@ -0,0 +1,27 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"sten/machine"
+)
+
+// machineCmd lists the registered machines and the config keys they read.
+func machineCmd(args []string) int {
+	if len(args) != 1 || args[0] != "list" {
+		fmt.Fprintln(os.Stderr, "usage: sten machine list")
+		return exitUsage
+	}
+	for _, d := range machine.Drivers() {
+		fmt.Printf("%s\t%s\n", d.Name, d.Description)
+		for _, s := range d.Schema {
+			fmt.Printf("    %-14s %s\n", s.Key, s.Description)
+		}
+	}
+	return exitOK
+}
@@ -6,31 +6,77 @@ package main
 
 import (
 	"fmt"
-	"log"
+	"io"
 	"os"
-	"os/signal"
-	"syscall"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
 
-	"sten/config"
-	"sten/engine"
+// Exit codes shared by every subcommand.
+const (
+	exitOK      = 0
+	exitFailure = 1 // something went wrong while working, or nothing found
+	exitUsage   = 2 // the command line could not be understood
+	exitConfig  = 3 // the config or dictionaries could not be used
 )
 
-func main() {
-	cfg, err := config.Load("config.json")
-	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
-	}
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
 
-	e := engine.NewEngine(cfg)
+var commands []command
 
-	go e.Run()
+func init() {
+	commands = []command{
+		{"run", "translate strokes from the configured machine and type them", runCmd},
+		{"translate", "print the text a file of strokes writes", translate},
+		{"lookup", "find how to write a word, or what an outline writes", lookup},
+		{"dict", "list dictionaries or add an entry", dict},
+		{"machine", "list the machines sten can read from", machineCmd},
+	}
+}
 
-	fmt.Println("[sten] Running. Press Ctrl+C to quit.")
+func main() {
+	os.Exit(dispatch(os.Args[1:]))
+}
 
-	// Handle Ctrl+C
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	<-sigs
-	fmt.Println("\n[sten] Quit with Ctrl+C")
-	e.Stop()
+// dispatch runs the subcommand named by args[0]. With no subcommand, or only
+// flags, sten runs as it always has.
+func dispatch(args []string) int {
+	if len(args) == 0 || (len(args[0]) > 0 && args[0][0] == '-') {
+		switch {
+		case len(args) > 0 && (args[0] == "--version" || args[0] == "-version"):
+			fmt.Println("sten", version)
+			return exitOK
+		case len(args) > 0 && (args[0] == "--help" || args[0] == "-help" || args[0] == "-h"):
+			usage(os.Stdout)
+			return exitOK
+		}
+		return runCmd(args)
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	if args[0] == "help" {
+		usage(os.Stdout)
+		return exitOK
+	}
+	fmt.Fprintf(os.Stderr, "sten: unknown command %q\n", args[0])
+	usage(os.Stderr)
+	return exitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: sten <command> [flags]")
+	fmt.Fprintln(w)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run sten <command> -h for its flags, or sten --version.")
 }
@@ -0,0 +1,187 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sten/config"
+)
+
+// isolate points the XDG folders at a temporary home, so tests never touch
+// the real config.
+func isolate(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(home, "data"))
+	t.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+	return home
+}
+
+func TestExitCodes(t *testing.T) {
+	isolate(t)
+	dir := t.TempDir()
+	dicts := filepath.Join(dir, "dictionaries")
+	if err := os.Mkdir(dicts, 0755); err != nil {
+		t.Fatalf("failed to make dictionaries: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dicts, "test_dict.json"), []byte(`{"WORLD": "world"}`), 0644); err != nil {
+		t.Fatalf("failed to write test dict: %v", err)
+	}
+	badConfig := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(badConfig, []byte(`{"machine": "qwerty", "dev": true}`), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"Version", []string{"--version"}, exitOK},
+		{"Help", []string{"help"}, exitOK},
+		{"Unknown Command", []string{"frobnicate"}, exitUsage},
+		{"Bad Flag", []string{"run", "--frobnicate"}, exitUsage},
+		{"Missing Config", []string{"run", "--config", filepath.Join(dir, "missing.json")}, exitConfig},
+		{"Unknown Machine", []string{"run", "--config", badConfig, "--dictionaries", dicts}, exitConfig},
+		{"Machine List", []string{"machine", "list"}, exitOK},
+		{"Machine Usage", []string{"machine"}, exitUsage},
+		{"Lookup", []string{"lookup", "--dictionaries", dicts, "world"}, exitOK},
+		{"Lookup Missing", []string{"lookup", "--dictionaries", dicts, "planet"}, exitFailure},
+		{"Lookup Usage", []string{"lookup"}, exitUsage},
+		{"Lookup Steno", []string{"lookup", "--dictionaries", dicts, "-steno", "WORLD"}, exitOK},
+		{"Lookup Bad Steno", []string{"lookup", "--dictionaries", dicts, "-steno", "WORLQ"}, exitUsage},
+		{"Lookup Bad Steno Prefix", []string{"lookup", "--dictionaries", dicts, "-steno", "-prefix", "WOA"}, exitUsage},
+		{"Lookup No Dictionaries", []string{"lookup", "--dictionaries", filepath.Join(dir, "missing"), "world"}, exitConfig},
+		{"Dict List", []string{"dict", "--dictionaries", dicts, "list"}, exitOK},
+		{"Dict Add", []string{"dict", "--dictionaries", dicts, "add", "PHRAPB/ET", "planet"}, exitOK},
+		{"Lookup Added", []string{"lookup", "--dictionaries", dicts, "planet"}, exitOK},
+		{"Dict Add Bad Outline", []string{"dict", "--dictionaries", dicts, "add", "PHRAPB/QET", "planet"}, exitUsage},
+		{"Dict Add Multi-Stroke Toggle", []string{"dict", "--dictionaries", dicts, "add", "PHROLG/PHROLG", "{PLOVER:TOGGLE}"}, exitUsage},
+		{"Dict Add Out Of Order", []string{"dict", "--dictionaries", dicts, "add", "OA", "planet"}, exitUsage},
+		{"Dict Usage", []string{"dict", "add", "PHRAPB"}, exitUsage},
+		{"Translate Unknown Format", []string{"translate", "--format", "qwerty"}, exitUsage},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code := dispatch(tc.args); code != tc.code {
+				t.Errorf("sten %v: want exit code %d, got %d", tc.args, tc.code, code)
+			}
+		})
+	}
+}
+
+func TestFirstRun(t *testing.T) {
+	home := isolate(t)
+	if code := dispatch([]string{"lookup", "world"}); code != exitOK {
+		t.Fatalf("want exit code %d, got %d", exitOK, code)
+	}
+
+	cfg, err := config.Load(filepath.Join(home, "config", "sten", "config.json"))
+	if err != nil {
+		t.Fatalf("expected a default config: %v", err)
+	}
+	if cfg.Machine != config.Default().Machine {
+		t.Errorf("expected the default machine, got %q", cfg.Machine)
+	}
+	for _, name := range []string{"lapwing-base.json", "lapwing-commands.json"} {
+		if _, err := os.Stat(filepath.Join(home, "data", "sten", "dictionaries", name)); err != nil {
+			t.Errorf("expected %s to be copied: %v", name, err)
+		}
+	}
+
+	// Entries are added to the user dictionary in the data folder, and an
+	// edited config is left alone.
+	if code := dispatch([]string{"dict", "add", "PHRAPB/ET", "planet"}); code != exitOK {
+		t.Fatalf("want exit code %d, got %d", exitOK, code)
+	}
+	if _, err := os.Stat(filepath.Join(home, "data", "sten", "dictionaries", "user.json")); err != nil {
+		t.Errorf("expected a user dictionary: %v", err)
+	}
+	cfg.Snapshot = "snapshot.json"
+	if err := cfg.Save(filepath.Join(home, "config", "sten", "config.json")); err != nil {
+		t.Fatalf("failed to save config: %v", err)
+	}
+	var opts options
+	loaded, err := opts.load()
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if want := filepath.Join(home, "state", "sten", "snapshot.json"); loaded.Snapshot != want {
+		t.Errorf("expected snapshot at %s, got %s", want, loaded.Snapshot)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	isolate(t)
+	dir := t.TempDir()
+	dicts := filepath.Join(dir, "dictionaries")
+	if err := os.Mkdir(dicts, 0755); err != nil {
+		t.Fatalf("failed to make dictionaries: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dicts, "test_dict.json"), []byte(`{"WORLD": "world", "-D": "dee", "-Z": "zed"}`), 0644); err != nil {
+		t.Fatalf("failed to write test dict: %v", err)
+	}
+	cfgPath := filepath.Join(dir, "config.json")
+	// No serial port: translating never opens the machine.
+	cfg := `{"machine": "geminipr", "baud_rate": "fast", "custom_keys": {"-D": "-Z"}, "untranslate": "buffer"}`
+	if err := os.WriteFile(cfgPath, []byte(cfg), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cases := []struct {
+		name     string
+		format   string
+		input    string
+		expected string
+	}{
+		// Buffered untranslates are typed once the input runs out.
+		{"Steno", "steno", "WORLD/TPH\n", "world TPH \n"},
+		// The physical -D key is laid out as -Z by custom_keys.
+		{"Gemini", "gemini", "\x80\x00\x00\x00\x01\x00", "zed \n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			in := filepath.Join(t.TempDir(), "input")
+			if err := os.WriteFile(in, []byte(tc.input), 0644); err != nil {
+				t.Fatalf("failed to write input: %v", err)
+			}
+			var code int
+			out := captureStdout(t, func() {
+				code = dispatch([]string{"translate", "--config", cfgPath, "--dictionaries", dicts, "--format", tc.format, in})
+			})
+			if code != exitOK {
+				t.Fatalf("want exit code %d, got %d", exitOK, code)
+			}
+			if out != tc.expected {
+				t.Errorf("want %q, got %q", tc.expected, out)
+			}
+		})
+	}
+}
+
+// captureStdout returns what f prints to stdout.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to make pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	f()
+	os.Stdout = stdout
+	w.Close()
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to read stdout: %v", err)
+	}
+	return string(out)
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package output
+
+// Document is the text left behind by a stream of outputs, as if they had
+// been typed into an empty text field.
+type Document struct {
+	text []rune
+}
+
+// Apply backspaces over o.Undo and then types o.Write.
+func (d *Document) Apply(o Output) {
+	n := len([]rune(o.Undo))
+	if n > len(d.text) {
+		n = len(d.text)
+	}
+	d.text = append(d.text[:len(d.text)-n], []rune(o.Write)...)
+}
+
+func (d *Document) String() string {
+	return string(d.text)
+}
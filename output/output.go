@@ -4,6 +4,8 @@
 
 package output
 
+import "time"
+
 type OutputService interface {
 	Run()
 }
@@ -11,6 +13,7 @@ type OutputService interface {
 type Output struct {
 	Write string
 	Undo  string
+	Time  time.Time // when the stroke behind this output was captured
 }
 
 func NewOutput(write, undo string) Output {
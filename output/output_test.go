@@ -4,20 +4,45 @@
 
 package output
 
-//// TestDevOutputType manually verifies that typing a string does not panic.
-//// Since robotgo actually types to the real system, this test only confirms no crash.
-//func TestDevOutputType(t *testing.T) {
-//	in := make(chan Output, 2)
-//	out := NewDevOutputService(in)
-//
-//	// Run the output processing in a goroutine
-//	go out.Run()
-//
-//	// Send a test command
-//	in <- Output{Type: Writing, Text: "hello world"}
-//	close(in)
-//
-//	// Optionally: if your service writes to the real keyboard, you probably don't want to actually do that during tests.
-//	// So just make sure it doesn't panic and you can check logs/output.
-//	t.Log("Typed 'hello world' (manually verify if you want)")
-//}
+import "testing"
+
+func TestDocument(t *testing.T) {
+	cases := []struct {
+		name     string
+		outputs  []Output
+		expected string
+	}{
+		{
+			name:     "Writes",
+			outputs:  []Output{{Write: "hello "}, {Write: "world "}},
+			expected: "hello world ",
+		},
+		{
+			name:     "Undo",
+			outputs:  []Output{{Write: "hello "}, {Write: "world "}, {Undo: "world "}},
+			expected: "hello ",
+		},
+		{
+			name:     "Replace",
+			outputs:  []Output{{Write: "café "}, {Write: "s ", Undo: " "}},
+			expected: "cafés ",
+		},
+		{
+			name:     "Undo Past Start",
+			outputs:  []Output{{Write: "hi"}, {Undo: "hello"}},
+			expected: "",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var d Document
+			for _, o := range tc.outputs {
+				d.Apply(o)
+			}
+			if got := d.String(); got != tc.expected {
+				t.Errorf("want %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
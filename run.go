@@ -0,0 +1,112 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"sten/engine"
+)
+
+// runCmd translates strokes from the configured machine until Ctrl+C.
+func runCmd(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	var opts options
+	opts.register(fs, true)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sten run [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	// Catch SIGHUP before anything starts, so one sent early is a reload
+	// rather than the default of quitting.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	cfg, err := opts.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[sten] Failed to load config: %v\n", err)
+		return exitConfig
+	}
+
+	e, err := engine.NewEngine(cfg)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Ctrl+C cancels the context, which stops the machine and lets the
+	// strokes already captured finish typing.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go reloadOnHangup(ctx, hup, e, &opts)
+
+	fmt.Println("[sten] Running. Press Ctrl+C to quit.")
+	if err := e.Run(ctx); err != nil {
+		return fail(err)
+	}
+	fmt.Println("\n[sten] Stopped")
+	return exitOK
+}
+
+// reloadOnHangup reads the config again on every SIGHUP received on hup until
+// ctx is done, so `kill -HUP` picks up a new port or edited dictionaries
+// without a restart.
+func reloadOnHangup(ctx context.Context, hup <-chan os.Signal, e *engine.Engine, opts *options) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		cfg, err := opts.load()
+		if err == nil {
+			err = e.Reload(cfg)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[sten] Failed to reload config: %v\n", err)
+			continue
+		}
+		fmt.Println("[sten] Reloaded config")
+	}
+}
+
+// fail prints err with a hint at how to fix it and returns the exit code.
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "[sten] %v\n", err)
+	var cfgErr *engine.ConfigError
+	var stageErr *engine.StageError
+	switch {
+	case errors.Is(err, engine.ErrUnknownMachine):
+		fmt.Fprintln(os.Stderr, `[sten] set "machine" in the config, or --machine, to one of the available machines`)
+		return exitConfig
+	case errors.Is(err, engine.ErrNoOutput):
+		fmt.Fprintln(os.Stderr, `[sten] set "dev": true in the config`)
+		return exitConfig
+	case errors.As(err, &cfgErr):
+		fmt.Fprintf(os.Stderr, "[sten] check %q in the config\n", cfgErr.Key)
+		return exitConfig
+	case errors.As(err, &stageErr) && stageErr.Stage == "dictionary":
+		fmt.Fprintln(os.Stderr, "[sten] check \"dictionaries\" in the config, or --dictionaries")
+		return exitConfig
+	case errors.As(err, &stageErr) && stageErr.Stage == "machine":
+		fmt.Fprintln(os.Stderr, "[sten] is the machine plugged in, and are you in its device group?")
+	}
+	return exitFailure
+}
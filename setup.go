@@ -0,0 +1,60 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"sten/config"
+)
+
+// bundled holds the dictionaries that ship with sten, copied into the data
+// folder on first run so they can be edited there.
+//
+//go:embed dictionaries/*.json
+var bundled embed.FS
+
+// ensureConfig writes the default config to path unless a file is there.
+func ensureConfig(path string) error {
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := config.Default().Save(path); err != nil {
+		return fmt.Errorf("could not create config: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "[sten] Created a default config at %s\n", path)
+	return nil
+}
+
+// ensureDictionaries copies the bundled dictionaries into folder unless it
+// already exists.
+func ensureDictionaries(folder string) error {
+	if _, err := os.Stat(folder); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	entries, err := bundled.ReadDir("dictionaries")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return fmt.Errorf("could not create dictionaries: %w", err)
+	}
+	for _, entry := range entries {
+		data, err := bundled.ReadFile("dictionaries/" + entry.Name())
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(folder, entry.Name()), data, 0644); err != nil {
+			return fmt.Errorf("could not copy dictionaries: %w", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "[sten] Copied the bundled dictionaries to %s\n", folder)
+	return nil
+}
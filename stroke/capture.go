@@ -0,0 +1,21 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package stroke
+
+import (
+	"time"
+)
+
+// Capture is a stroke as a machine read it: the keys, when they arrived and
+// the raw bytes they were decoded from.
+type Capture struct {
+	Stroke Stroke
+	Time   time.Time
+	Raw    []byte
+	// Extra names keys held with the stroke that are not steno keys, such
+	// as a Gemini PR machine's Fn and pwr, in the order the machine reads
+	// them.
+	Extra []string
+}
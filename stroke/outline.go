@@ -28,3 +28,24 @@ func (o Outline) String() string {
 func (s Stroke) Outline() Outline {
 	return Outline{s}
 }
+
+// ParseOutline parses slash separated steno such as "STKPHEPL/PWER" into an
+// Outline.
+func ParseOutline(steno string) Outline {
+	parts := strings.Split(steno, "/")
+	o := make(Outline, len(parts))
+	for i, part := range parts {
+		o[i] = ParseSteno(part)
+	}
+	return o
+}
+
+// CheckOutline runs CheckSteno on each stroke of slash separated steno.
+func CheckOutline(steno string) error {
+	for _, part := range strings.Split(steno, "/") {
+		if err := CheckSteno(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
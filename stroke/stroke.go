@@ -5,6 +5,7 @@
 package stroke
 
 import (
+	"fmt"
 	"strings"
 )
 
@@ -76,6 +77,9 @@ var rightKeys = []StenoKey{
 	{"Z", StenoZ},
 }
 
+// stenoKeyNames holds every key in the hyphen format JoinKeys takes.
+var stenoKeyNames = make(map[string]bool)
+
 var leftBits = make(map[string]uint32)
 var vowelBits = make(map[string]uint32)
 var rightBits = make(map[string]uint32)
@@ -84,12 +88,27 @@ var stenoBits []map[string]uint32
 func init() {
 	for _, k := range leftKeys {
 		leftBits[k.str] = k.bit
+		stenoKeyNames[k.str+"-"] = true
 	}
 	for _, k := range vowelKeys {
 		vowelBits[k.str] = k.bit
+		if k.bit != StenoDash {
+			stenoKeyNames[k.str] = true
+		}
 	}
 	for _, k := range rightKeys {
 		rightBits[k.str] = k.bit
+		stenoKeyNames["-"+k.str] = true
+	}
+	// Digits stand for their key with the number bar held, so "1-D" is "#S-D".
+	for _, d := range digitKeys {
+		for _, zone := range []map[string]uint32{leftBits, vowelBits, rightBits} {
+			for _, bit := range zone {
+				if bit == d.bit {
+					zone[d.str] = d.bit | StenoHash
+				}
+			}
+		}
 	}
 	// All three maps of bits in an array, zones are 0=left, 1=vowel, 2=right
 	stenoBits = []map[string]uint32{leftBits, vowelBits, rightBits}
@@ -140,6 +159,12 @@ func gatherBits(runes []rune, i int, zone int) Stroke {
 		if _, ok := vowelBits[key]; ok {
 			return gatherBits(runes, i, 1)
 		}
+		// Right hand keys may be written without a dash, e.g. "P-LT" as "PLT".
+		if _, ok := leftBits[key]; !ok {
+			if _, ok := rightBits[key]; ok {
+				return gatherBits(runes, i, 2)
+			}
+		}
 	case zoneVowel:
 		if _, ok := vowelBits[key]; !ok {
 			return gatherBits(runes, i, 2)
@@ -155,10 +180,54 @@ func gatherBits(runes []rune, i int, zone int) Stroke {
 	return bit | gatherBits(runes, i+1, zone)
 }
 
+// CheckSteno reports steno that ParseSteno would not read as written: an
+// empty stroke, a character that is not a key, or keys out of steno order.
+func CheckSteno(steno string) error {
+	if steno == "" {
+		return fmt.Errorf("empty stroke")
+	}
+	var order []StenoKey
+	order = append(order, leftKeys...)
+	order = append(order, vowelKeys[:len(vowelKeys)-1]...) // without the dash
+	order = append(order, rightKeys...)
+	digits := make(map[string]uint32, len(digitKeys))
+	for _, d := range digitKeys {
+		digits[d.str] = d.bit
+	}
+
+	next := 0 // index in order of the first key that may still follow
+	for _, r := range steno {
+		key := string(r)
+		if key == "-" {
+			// The dash stands in for the vowels, so only right keys follow.
+			next = max(next, len(leftKeys)+len(vowelKeys)-1)
+			continue
+		}
+		found := -1
+		for i := next; i < len(order); i++ {
+			if order[i].str == key || (digits[key] != 0 && order[i].bit == digits[key]) {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return fmt.Errorf("%q in %q is not a key in steno order", key, steno)
+		}
+		next = found + 1
+	}
+	return nil
+}
+
 func (s Stroke) String() string {
 	return s.Steno()
 }
 
+// IsKey reports whether key names a single steno key in the format JoinKeys
+// expects, e.g. "S-", "A", "*" or "-Z".
+func IsKey(key string) bool {
+	return stenoKeyNames[key]
+}
+
 // JoinKeys expects keys in steno hyphen format, e.g. "#- "S-", "R-", "A", "*", "U", "-R", "-S"
 func JoinKeys(keys []string) string {
 	var left, vowels, right []string
@@ -186,3 +255,35 @@ func JoinKeys(keys []string) string {
 	}
 	return leftStr + vowelStr + rightStr
 }
+
+// Digits in steno order, as written with the number bar held.
+var digitKeys = []StenoKey{
+	{"1", StenoS1},
+	{"2", StenoT},
+	{"3", StenoP},
+	{"4", StenoH},
+	{"5", StenoA},
+	{"0", StenoO},
+	{"6", StenoF},
+	{"7", StenoP2},
+	{"8", StenoL},
+	{"9", StenoT2},
+}
+
+// Digits returns the number a stroke writes with the number bar, e.g. "#SA"
+// is "15". It reports false unless the number key is held and every other key
+// has a digit.
+func (s Stroke) Digits() (string, bool) {
+	if s&Stroke(StenoHash) == 0 {
+		return "", false
+	}
+	rest := s &^ Stroke(StenoHash)
+	var digits Stroke
+	for _, k := range digitKeys {
+		digits |= Stroke(k.bit)
+	}
+	if rest == 0 || rest&^digits != 0 {
+		return "", false
+	}
+	return gatherKeys(rest, digitKeys, 0), true
+}
@@ -30,4 +30,62 @@ func TestStrokeTranslation(t *testing.T) {
 		t.Errorf("expected %q, got %q", want, got)
 	}
 
+	s = ParseSteno("PLT")
+	got = s.Steno()
+	want = "P-LT"
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	digits, ok := ParseSteno("#SAF").Digits()
+	if !ok || digits != "156" {
+		t.Errorf("expected %q, got %q", "156", digits)
+	}
+	if _, ok := ParseSteno("#SK").Digits(); ok {
+		t.Errorf("expected #SK to have no digits")
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	cases := []struct {
+		steno    string
+		expected string
+	}{
+		{"1-D", "#S-D"},
+		{"1", "#S"},
+		{"12", "#ST"},
+		{"#12", "#ST"},
+		{"50", "#AO"},
+		{"1EU9", "#SEUT"},
+		{"69", "#-FT"},
+	}
+	for _, tc := range cases {
+		if got := ParseSteno(tc.steno).Steno(); got != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.steno, tc.expected, got)
+		}
+	}
+}
+
+func TestCheckSteno(t *testing.T) {
+	cases := []struct {
+		steno string
+		valid bool
+	}{
+		{"STKPWHR", true},
+		{"-PLT", true},
+		{"PLT", true},
+		{"#S-D", true},
+		{"1-D", true},
+		{"AOEU", true},
+		{"", false},
+		{"hello", false},
+		{"OA", false},
+		{"-A", false},
+		{"S#", false},
+	}
+	for _, tc := range cases {
+		if err := CheckSteno(tc.steno); (err == nil) != tc.valid {
+			t.Errorf("%q: expected valid %v, got %v", tc.steno, tc.valid, err)
+		}
+	}
 }
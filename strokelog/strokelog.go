@@ -0,0 +1,189 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+// Package strokelog writes every stroke and every output to a log file, for
+// reviewing practice sessions and debugging dictionaries.
+//
+// The log has one record per line, with tab separated fields:
+//
+//	<time> stroke <steno> <raw> <extra>
+//	<time> output <undo> <write>
+//
+// time is when the stroke was captured, in RFC 3339 with nanoseconds. steno
+// is the stroke as in the dictionaries and raw is the machine packet in hex.
+// extra names the keys held that are not steno keys, joined with "+" as in
+// key bindings, and is empty if there were none.
+// undo is the text taken back before write is typed; both are Go quoted
+// strings, so an output with an empty undo wrote without correcting anything.
+//
+// Once the file grows past its size limit it is renamed to path.1, older logs
+// move up to path.2 and so on, and the oldest past the keep limit is removed.
+package strokelog
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sten/output"
+	"sten/stroke"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default limits used when Open is given zero.
+const (
+	DefaultMaxSize = 10 << 20
+	DefaultKeep    = 5
+)
+
+// Logger appends stroke and output records to a rotating log file. It is
+// safe to use from several goroutines.
+type Logger struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	file    *os.File
+	size    int64
+	failing bool // the last record was lost, and that was logged
+	closed  bool
+}
+
+// Open opens the log at path for appending, creating it if needed.
+func Open(path string, maxSize int64, keep int) (*Logger, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+	l := &Logger{path: path, maxSize: maxSize, keep: keep}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Logger) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open stroke log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not open stroke log: %w", err)
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// Stroke records a captured stroke.
+func (l *Logger) Stroke(c stroke.Capture) error {
+	return l.write(c.Time, "stroke", c.Stroke.Steno(), hex.EncodeToString(c.Raw), strings.Join(c.Extra, "+"))
+}
+
+// Output records what was typed for a stroke.
+func (l *Logger) Output(out output.Output) error {
+	return l.write(out.Time, "output", strconv.Quote(out.Undo), strconv.Quote(out.Write))
+}
+
+func (l *Logger) write(at time.Time, kind string, fields ...string) error {
+	line := at.Format(time.RFC3339Nano) + "\t" + kind
+	for _, f := range fields {
+		line += "\t" + f
+	}
+	line += "\n"
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return os.ErrClosed
+	}
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.WriteString(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate shifts path.N to path.N+1, dropping the one past keep, and starts a
+// new file at path.
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("could not rotate stroke log: %w", err)
+	}
+	l.file = nil
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.keep))
+	for i := l.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return fmt.Errorf("could not rotate stroke log: %w", err)
+	}
+	return l.open()
+}
+
+// TeeStrokes logs every stroke from in and passes it on to the returned
+// channel, which is closed once in is.
+func (l *Logger) TeeStrokes(in chan stroke.Capture) chan stroke.Capture {
+	out := make(chan stroke.Capture, cap(in))
+	go func() {
+		defer close(out)
+		for c := range in {
+			l.report(l.Stroke(c))
+			out <- c
+		}
+	}()
+	return out
+}
+
+// TeeOutputs logs every output from in and passes it on to the returned
+// channel, which is closed once in is.
+func (l *Logger) TeeOutputs(in chan output.Output) chan output.Output {
+	out := make(chan output.Output, cap(in))
+	go func() {
+		defer close(out)
+		for o := range in {
+			l.report(l.Output(o))
+			out <- o
+		}
+	}()
+	return out
+}
+
+// report logs err, the result of writing a record, unless the record before
+// was lost too, so a log that stops working is reported once rather than for
+// every stroke.
+func (l *Logger) report(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err == nil || l.closed {
+		l.failing = false
+		return
+	}
+	if !l.failing {
+		log.Printf("Stroke log stopped writing: %v", err)
+	}
+	l.failing = true
+}
+
+// Close closes the log file. Later records are dropped.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
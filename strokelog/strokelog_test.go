@@ -0,0 +1,107 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package strokelog
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"sten/output"
+	"sten/stroke"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strokes.log")
+	l, err := Open(path, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	at := time.Date(2025, 1, 2, 3, 4, 5, 600, time.UTC)
+
+	strokes := make(chan stroke.Capture, 2)
+	outputs := make(chan output.Output, 1)
+	strokesOut := l.TeeStrokes(strokes)
+	outputsOut := l.TeeOutputs(outputs)
+	strokes <- stroke.Capture{Stroke: stroke.ParseSteno("KOPL"), Time: at, Raw: []byte{0x80, 0x01}}
+	<-strokesOut
+	strokes <- stroke.Capture{Time: at, Raw: []byte{0xc0, 0x00}, Extra: []string{"Fn", "pwr"}}
+	<-strokesOut
+	outputs <- output.Output{Write: "complete ", Undo: "come ", Time: at}
+	<-outputsOut
+	close(strokes)
+	close(outputs)
+	l.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	want := "2025-01-02T03:04:05.0000006Z\tstroke\tKOPL\t8001\t\n" +
+		"2025-01-02T03:04:05.0000006Z\tstroke\t\tc000\tFn+pwr\n" +
+		"2025-01-02T03:04:05.0000006Z\toutput\t\"come \"\t\"complete \"\n"
+	if string(data) != want {
+		t.Errorf("expected log\n%s\ngot\n%s", want, data)
+	}
+}
+
+func TestLoggerRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "strokes.log")
+	l, err := Open(path, 100, 2)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := l.Output(output.Output{Write: strings.Repeat("x", 30)}); err != nil {
+			t.Fatalf("failed to write log: %v", err)
+		}
+	}
+	l.Close()
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("expected %s to exist: %v", name, err)
+		}
+		if info.Size() > 100 {
+			t.Errorf("expected %s to stay under 100 bytes, got %d", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Errorf("expected only 2 old logs to be kept")
+	}
+}
+
+func TestLoggerReportsFailure(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	l, err := Open(filepath.Join(dir, "strokes.log"), 10, 0)
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	// With the folder gone the log cannot rotate, so every record after
+	// the first is lost.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("failed to remove log folder: %v", err)
+	}
+	outputs := make(chan output.Output, 3)
+	outputsOut := l.TeeOutputs(outputs)
+	for range 3 {
+		outputs <- output.Output{Write: "word "}
+		<-outputsOut
+	}
+	close(outputs)
+	l.Close()
+
+	if n := strings.Count(logged.String(), "Stroke log stopped writing"); n != 1 {
+		t.Errorf("expected the failure to be logged once, got %d times:\n%s", n, logged.String())
+	}
+}
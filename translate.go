@@ -0,0 +1,107 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"sten/config"
+	"sten/engine"
+	"sten/machine"
+	"sten/output"
+	"sten/translator"
+)
+
+// formats maps the translate input formats to the machine drivers that read
+// them.
+var formats = map[string]string{
+	"steno":  "replay",
+	"gemini": "geminipr",
+}
+
+// translate reads strokes from a file or stdin and prints the text they
+// produce, without a stenotype or keyboard output.
+func translate(args []string) int {
+	fs := flag.NewFlagSet("translate", flag.ContinueOnError)
+	format := fs.String("format", "steno", "input format: steno (outlines or a stroke log) or gemini (raw Gemini PR packets)")
+	var opts options
+	opts.register(fs, false)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sten translate [flags] [file]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var in io.Reader = os.Stdin
+	if fs.NArg() == 1 && fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sten translate: %v\n", err)
+			return exitFailure
+		}
+		defer f.Close()
+		in = f
+	}
+
+	name, ok := formats[*format]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "sten translate: unknown format %q\n", *format)
+		return exitUsage
+	}
+	driver, err := machine.Lookup(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sten translate: %v\n", err)
+		return exitFailure
+	}
+
+	// Only what translating uses is checked, so a machine that is never
+	// opened need not be set up.
+	opts.validate = func(cfg *config.Config, read []config.Problem) []config.Problem {
+		return cfg.ValidateTranslate(driver, read)
+	}
+	cfg, err := opts.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sten translate: %v\n", err)
+		return exitConfig
+	}
+	m, err := driver.New(machine.Settings{Keys: cfg.CustomKeys, Reader: in})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sten translate: custom_keys: %v\n", err)
+		return exitConfig
+	}
+	topts, err := engine.TranslatorOptions(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sten translate: %v\n", err)
+		return exitConfig
+	}
+	dict, layers, longestOutline, err := engine.LoadDictionaries(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sten translate: %v\n", err)
+		return exitConfig
+	}
+	topts = append(topts, translator.WithLayers(layers))
+	t := translator.NewTranslator(dict, longestOutline, m.Strokes(), topts...)
+	go t.Run()
+	if err := m.StartCapture(); err != nil {
+		fmt.Fprintf(os.Stderr, "sten translate: %v\n", err)
+		return exitFailure
+	}
+
+	var doc output.Document
+	for o := range t.Out() {
+		doc.Apply(o)
+	}
+	fmt.Println(doc.String())
+	return exitOK
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package translator
+
+import (
+	"sten/dictionary"
+	"sten/stroke"
+)
+
+// commandLookup logs how the last word can be written.
+const commandLookup = "{PLOVER:LOOKUP}"
+
+// LookupLimit is how many matches a lookup reports.
+const LookupLimit = 10
+
+// isCommand reports entries that type nothing and leave no trace in the
+// history, so undo skips over them. The translator carries out lookups
+// itself; the engine acts on the state commands before they get here.
+func isCommand(raw string) bool {
+	switch raw {
+	case commandLookup, dictionary.CommandToggle, dictionary.CommandSuspend, dictionary.CommandResume:
+		return true
+	}
+	return false
+}
+
+func newCommand(raw string, outline stroke.Outline) *Translation {
+	return &Translation{
+		result:  Result{raw, "", ""},
+		outline: outline,
+	}
+}
+
+func (tr *Translator) runCommand(t *Translation) {
+	switch t.result.raw {
+	case commandLookup:
+		tr.lookupLastWord(t)
+	}
+}
+
+// lookupLastWord searches the dictionary for the word last typed, so the
+// writer can see how else it could have been stroked. Close spellings are
+// included to help with a word that came out wrong.
+func (tr *Translator) lookupLastWord(t *Translation) {
+	s, ok := tr.dict.(dictionary.Searcher)
+	if !ok {
+		return
+	}
+	e := Event{Kind: EventLookup, Outline: t.outline, Time: t.time}
+	if words := tr.tail.words(1); len(words) > 0 {
+		e.Text = words[0]
+		e.Matches = s.Search(e.Text, dictionary.SearchFuzzy, LookupLimit)
+	}
+	tr.emit(e)
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package translator
+
+import (
+	"regexp"
+	"sten/output"
+	"sten/stroke"
+	"strings"
+)
+
+// conditional holds a parsed {=REGEX/if-match/otherwise} entry. Which text
+// is written depends on the translation that follows it, so the choice is
+// made again every time a new translation lands directly after it.
+type conditional struct {
+	pattern   *regexp.Regexp
+	match     string
+	otherwise string
+}
+
+// parseConditional splits a {=REGEX/if-match/otherwise} entry. A slash can
+// be escaped with a backslash inside any of the three parts.
+func parseConditional(raw string) (*conditional, bool) {
+	if !strings.HasPrefix(raw, "{=") || !strings.HasSuffix(raw, "}") {
+		return nil, false
+	}
+	parts := splitUnescaped(raw[2:len(raw)-1], '/')
+	if len(parts) != 3 {
+		return nil, false
+	}
+	pattern, err := regexp.Compile("^(?:" + parts[0] + ")")
+	if err != nil {
+		return nil, false
+	}
+	return &conditional{
+		pattern:   pattern,
+		match:     parts[1],
+		otherwise: parts[2],
+	}, true
+}
+
+func splitUnescaped(s string, sep rune) []string {
+	var parts []string
+	var b strings.Builder
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			if r != sep {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == sep:
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if escaped {
+		b.WriteRune('\\')
+	}
+	return append(parts, b.String())
+}
+
+// pick returns the text to write given the text that follows.
+func (c *conditional) pick(next string) string {
+	if c.pattern.MatchString(next) {
+		return c.match
+	}
+	return c.otherwise
+}
+
+func (tr *Translator) newConditional(c *conditional, raw string, outline stroke.Outline) *Translation {
+	return &Translation{
+		result:  tr.spaced(raw, c.otherwise, false),
+		outline: outline,
+		cond:    c,
+	}
+}
+
+// resolve re-picks the text of a conditional prev directly preceding t. When
+// the choice changes, the conditional is rewritten in place and t carries a
+// correction that retypes it along with whatever t itself replaces. visible
+// and restore describe the translations t consumed, as from onScreen.
+func (tr *Translator) resolve(t, prev *Translation, visible, restore string) *Translation {
+	if prev == nil || prev.cond == nil {
+		return t
+	}
+	text := tr.spaced(prev.result.raw, prev.cond.pick(strings.TrimSpace(t.result.text)), false).text
+	if text == prev.result.text {
+		return t
+	}
+	n := len([]rune(restore))
+	correction := compose(
+		output.NewOutput(trimEnd(text, n)+visible, trimEnd(prev.result.text, n)+visible),
+		t.write(),
+	)
+	// prev now types the new text, so undoing it takes back the right one.
+	prev.typed = compose(prev.typed, output.NewOutput(text, prev.result.text))
+	prev.result.text = text
+	t.correction = &correction
+	return t
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package translator
+
+import (
+	"sten/dictionary"
+	"sten/stroke"
+	"time"
+)
+
+// EventKind tells what an Event reports.
+type EventKind int
+
+const (
+	// EventUntranslate is sent when strokes with no dictionary entry show
+	// up in the output.
+	EventUntranslate EventKind = iota
+	// EventLookup is sent when a lookup stroke asks how the last word can
+	// be written. Text is the word and Matches what the dictionary has.
+	EventLookup
+)
+
+// Event reports something a UI may want to show alongside the output, such
+// as highlighting an untranslate.
+type Event struct {
+	Kind    EventKind
+	Outline stroke.Outline
+	Text    string
+	Time    time.Time // when the stroke behind the event was captured
+	Matches []dictionary.Match
+}
+
+func (tr *Translator) Events() chan Event {
+	return tr.events
+}
+
+// emit never blocks; events are dropped when nobody keeps up with them.
+func (tr *Translator) emit(e Event) {
+	select {
+	case tr.events <- e:
+	default:
+	}
+}
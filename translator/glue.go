@@ -0,0 +1,31 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package translator
+
+import (
+	"sten/stroke"
+	"strings"
+)
+
+// parseGlue returns the text of a {&text} entry. Glue attaches to glue right
+// before it without a space, so fingerspelled letters and numbers form words.
+func parseGlue(raw string) (string, bool) {
+	if !strings.HasPrefix(raw, "{&") || !strings.HasSuffix(raw, "}") {
+		return "", false
+	}
+	text := raw[2 : len(raw)-1]
+	if text == "" || strings.ContainsAny(text, "{}") {
+		return "", false
+	}
+	return text, true
+}
+
+func (tr *Translator) newGlue(raw, text string, outline stroke.Outline, prev *Translation) *Translation {
+	return &Translation{
+		result:  tr.spaced(raw, text, prev != nil && prev.glue),
+		outline: outline,
+		glue:    true,
+	}
+}
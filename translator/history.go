@@ -0,0 +1,64 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package translator
+
+// history is a fixed-size ring of the most recent translations. Pushing onto
+// a full ring drops the oldest translation, so memory stays bounded no matter
+// how long a session runs.
+type history struct {
+	entries []*Translation
+	head    int // index of the oldest translation
+	size    int
+}
+
+func newHistory(depth int) *history {
+	if depth < 1 {
+		depth = 1
+	}
+	return &history{entries: make([]*Translation, depth)}
+}
+
+func (h *history) push(t *Translation) {
+	if h.size == len(h.entries) {
+		h.entries[h.head] = nil
+		h.head = (h.head + 1) % len(h.entries)
+		h.size--
+	}
+	h.entries[(h.head+h.size)%len(h.entries)] = t
+	h.size++
+}
+
+// pop removes and returns the latest translation, or nil if empty.
+func (h *history) pop() *Translation {
+	if h.size == 0 {
+		return nil
+	}
+	h.size--
+	i := (h.head + h.size) % len(h.entries)
+	t := h.entries[i]
+	h.entries[i] = nil
+	return t
+}
+
+// peek returns the translation n steps back from the latest, so peek(0) is
+// the latest. It returns nil past the oldest translation.
+func (h *history) peek(n int) *Translation {
+	if n < 0 || n >= h.size {
+		return nil
+	}
+	return h.entries[(h.head+h.size-1-n)%len(h.entries)]
+}
+
+// last returns the n latest translations, oldest first.
+func (h *history) last(n int) []*Translation {
+	if n > h.size {
+		n = h.size
+	}
+	ts := make([]*Translation, n)
+	for i := range ts {
+		ts[i] = h.peek(n - 1 - i)
+	}
+	return ts
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package translator
+
+import (
+	"sten/dictionary"
+)
+
+// Layers maps extra keys, joined with "+" as a machine reports them, to a
+// dictionary that strokes written with those keys held are looked up in
+// before the main one. A key such as Fn can so shift to a second set of
+// entries, while the strokes it does not cover write as usual.
+type Layers map[string]dictionary.Dict
+
+// WithLayers sets the dictionaries held extra keys shift to. The outline cap
+// given to the translator must cover their outlines too.
+func WithLayers(layers Layers) Option {
+	return func(tr *Translator) {
+		tr.layers = layers
+	}
+}
+
+// SetLayers replaces the layer dictionaries. Call SetDictionary first if
+// their outlines are longer than the main dictionary's.
+func (tr *Translator) SetLayers(layers Layers) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.layers = layers
+}
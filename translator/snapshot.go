@@ -0,0 +1,97 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package translator
+
+import (
+	"sten/output"
+	"sten/stroke"
+)
+
+// Snapshot is the translator state needed to carry on writing where it left
+// off: the history used for multi-stroke matching and undo, how each
+// translation was spaced, and the end of the document. It encodes to JSON as
+// is.
+type Snapshot struct {
+	History []SnapshotEntry `json:"history"`
+	Tail    string          `json:"tail,omitempty"`
+}
+
+// SnapshotEntry is one translation in a Snapshot.
+type SnapshotEntry struct {
+	Outline  string          `json:"outline"`
+	Raw      string          `json:"raw"`
+	Text     string          `json:"text"`
+	Trim     string          `json:"trim,omitempty"`
+	Write    string          `json:"write"`
+	Undo     string          `json:"undo,omitempty"`
+	Glue     bool            `json:"glue,omitempty"`
+	Pending  bool            `json:"pending,omitempty"`
+	Replaced []SnapshotEntry `json:"replaced,omitempty"`
+}
+
+// Snapshot returns the current state, oldest translation first.
+func (tr *Translator) Snapshot() Snapshot {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return Snapshot{
+		History: snapshotEntries(tr.history.last(tr.history.size)),
+		Tail:    string(tr.tail.text),
+	}
+}
+
+// Restore replaces the history with the one in s. Translations past the
+// history depth are dropped, oldest first.
+func (tr *Translator) Restore(s Snapshot) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.history = newHistory(len(tr.history.entries))
+	for _, t := range restoreEntries(s.History) {
+		tr.history.push(t)
+	}
+	tr.tail.text = tr.tail.text[:0]
+	tr.tail.apply(output.NewOutput(s.Tail, ""))
+}
+
+func snapshotEntries(ts []*Translation) []SnapshotEntry {
+	if len(ts) == 0 {
+		return nil
+	}
+	entries := make([]SnapshotEntry, len(ts))
+	for i, t := range ts {
+		entries[i] = SnapshotEntry{
+			Outline:  t.outline.String(),
+			Raw:      t.result.raw,
+			Text:     t.result.text,
+			Trim:     t.result.trim,
+			Write:    t.typed.Write,
+			Undo:     t.typed.Undo,
+			Glue:     t.glue,
+			Pending:  t.pending,
+			Replaced: snapshotEntries(t.replaced),
+		}
+	}
+	return entries
+}
+
+func restoreEntries(entries []SnapshotEntry) []*Translation {
+	if len(entries) == 0 {
+		return nil
+	}
+	ts := make([]*Translation, len(entries))
+	for i, e := range entries {
+		ts[i] = &Translation{
+			result:   Result{e.Raw, e.Text, e.Trim},
+			typed:    output.NewOutput(e.Write, e.Undo),
+			outline:  stroke.ParseOutline(e.Outline),
+			replaced: restoreEntries(e.Replaced),
+			glue:     e.Glue,
+			pending:  e.Pending,
+		}
+		if c, ok := parseConditional(e.Raw); ok {
+			ts[i].cond = c
+		}
+	}
+	return ts
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package translator
+
+import (
+	"sten/output"
+	"strings"
+	"unicode"
+)
+
+// DefaultTailSize is how many characters of the document are kept when no
+// WithTailSize option is given.
+const DefaultTailSize = 1024
+
+// WithTailSize sets how many characters at the end of the document the
+// translator keeps track of for Tail and Words.
+func WithTailSize(size int) Option {
+	return func(tr *Translator) {
+		tr.tail.size = size
+	}
+}
+
+// tail is the end of the output document, rebuilt from the outputs the
+// translator sends. Undoing past what it kept just empties it.
+type tail struct {
+	text []rune
+	size int
+}
+
+func (t *tail) apply(out output.Output) {
+	n := len([]rune(out.Undo))
+	if n > len(t.text) {
+		n = len(t.text)
+	}
+	t.text = append(t.text[:len(t.text)-n], []rune(out.Write)...)
+	if over := len(t.text) - t.size; over > 0 {
+		t.text = append(t.text[:0], t.text[over:]...)
+	}
+}
+
+// Tail returns up to the last k characters of the document typed so far.
+// A negative k counts as 0.
+func (tr *Translator) Tail(k int) string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	k = max(k, 0)
+	text := tr.tail.text
+	if k < len(text) {
+		text = text[len(text)-k:]
+	}
+	return string(text)
+}
+
+// Words returns up to the last n words of the document, oldest first. A word
+// cut off at the start of what is kept counts as a word. A negative n counts
+// as 0.
+func (tr *Translator) Words(n int) []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.tail.words(n)
+}
+
+func (t *tail) words(n int) []string {
+	n = max(n, 0)
+	words := strings.FieldsFunc(string(t.text), unicode.IsSpace)
+	if n < len(words) {
+		words = words[len(words)-n:]
+	}
+	return words
+}
+
+// WordBoundaries returns the rune offsets into Tail(k) where each word
+// starts, so callers can map words back to the text around them.
+func (tr *Translator) WordBoundaries(k int) []int {
+	var starts []int
+	inWord := false
+	for i, r := range []rune(tr.Tail(k)) {
+		space := unicode.IsSpace(r)
+		if !space && !inWord {
+			starts = append(starts, i)
+		}
+		inWord = !space
+	}
+	return starts
+}
@@ -5,174 +5,430 @@
 package translator
 
 import (
+	"fmt"
 	"sten/dictionary"
 	"sten/output"
 	"sten/stroke"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Translation struct {
-	result   Result
-	outline  stroke.Outline
-	prev     *Translation // previous
-	replaced *Translation // store replaced translations
+	result     Result
+	typed      output.Output // what typing it takes, including taking back what it consumed
+	outline    stroke.Outline
+	replaced   []*Translation // translations this one consumed, restored on undo
+	cond       *conditional   // set for {=REGEX/if-match/otherwise} entries
+	correction *output.Output // overrides typed when a neighbour was rewritten
+	pending    bool           // buffered untranslate, not typed yet
+	glue       bool           // attaches to neighbouring glue without a space
+	time       time.Time      // when its last stroke was captured
 }
 
 type Result struct {
-	raw      string
-	text     string
-	replaced string // cache of replaced result
+	raw  string
+	text string // text this translation adds
+	trim string // text it removes from the end of what came before it
 }
 
 func (r *Result) write() output.Output {
-	return output.NewOutput(r.text, r.replaced)
+	return output.NewOutput(r.text, r.trim)
 }
 
-func (tr *Translator) newTranslation(raw, replaced string, outline stroke.Outline, prev *Translation) *Translation {
+// revert is the output that takes back write.
+func (r *Result) revert() output.Output {
+	return output.NewOutput(r.trim, r.text)
+}
+
+func (t *Translation) write() output.Output {
+	if t.correction != nil {
+		return *t.correction
+	}
+	return t.typed
+}
+
+func (tr *Translator) newTranslation(raw string, outline stroke.Outline, prev *Translation) *Translation {
 	if raw == "=undo" {
-		return newUndo(raw, outline, prev)
+		return newUndo(raw, outline, tr.history.peek(0))
+	} else if isCommand(raw) {
+		return newCommand(raw, outline)
 		//	} else if raw == "=repeat_last_translation" {
 		//		return Translation{tr.latest.result, tr.latest.outline, }
+	} else if c, ok := parseConditional(raw); ok {
+		return tr.newConditional(c, raw, outline)
+	} else if text, ok := parseGlue(raw); ok {
+		return tr.newGlue(raw, text, outline, prev)
 	} else if strings.HasPrefix(raw, "{^}") {
 		suffix := raw[3:]
-		return newSuffix(raw, suffix, outline, prev)
-	} else if len(outline) == 1 {
-		return newSingleStroke(raw, outline, prev)
+		return tr.newSuffix(raw, suffix, outline)
 	} else {
-		return newMultiStroke(raw, replaced, outline, prev, tr.latest)
+		return tr.newWord(raw, outline)
+	}
+}
+
+// DefaultUndoDepth is how many translations can be undone in a row when no
+// WithUndoDepth option is given.
+const DefaultUndoDepth = 100
+
+// UndoMode selects what a single =undo takes back.
+type UndoMode int
+
+const (
+	// UndoStroke removes only the last stroke and translates the remaining
+	// strokes of that translation again, like Plover.
+	UndoStroke UndoMode = iota
+	// UndoTranslation removes the whole last translation and restores the
+	// translations it replaced.
+	UndoTranslation
+)
+
+// ParseUndoMode maps the config names "stroke" and "translation" to an
+// UndoMode.
+func ParseUndoMode(name string) (UndoMode, error) {
+	switch name {
+	case "stroke":
+		return UndoStroke, nil
+	case "translation":
+		return UndoTranslation, nil
+	default:
+		return 0, fmt.Errorf("unknown undo mode %q", name)
 	}
 }
 
 // Translator is the main engine for converting strokes to translations.
 type Translator struct {
+	mu         sync.Mutex // guards history, dict and layers between Run and the other methods
 	dict       dictionary.Dict
-	latest     *Translation
+	history    *history
+	undoDepth  int
+	undoMode   UndoMode
+	spaceMode  SpaceMode
 	outlineCap int
-	in         chan stroke.Stroke
+	in         chan stroke.Capture
 	out        chan output.Output
+	events     chan Event
+	tail       tail
+	now        time.Time // capture time of the stroke being translated
+	layers     Layers
+	layer      dictionary.Dict // layer held with the stroke being translated
+
+	untranslateMode   UntranslateMode
+	untranslateMarker string
 }
 
-func newSingleStroke(raw string, outline stroke.Outline, prev *Translation) *Translation {
-	return &Translation{
-		result:   Result{raw, raw + " ", ""},
-		outline:  outline,
-		prev:     prev,
-		replaced: nil,
+// Option configures a Translator.
+type Option func(*Translator)
+
+// WithUndoMode sets whether an undo removes a stroke or a translation.
+func WithUndoMode(mode UndoMode) Option {
+	return func(tr *Translator) {
+		tr.undoMode = mode
 	}
 }
 
-func newMultiStroke(raw, replaced string, outline stroke.Outline, prev, replacedPtr *Translation) *Translation {
-	return &Translation{
-		result:   Result{raw, raw + " ", replaced},
-		outline:  outline,
-		prev:     prev,
-		replaced: replacedPtr,
+// WithUndoDepth sets how many translations are remembered for undo. The
+// history always keeps at least outlineCap translations for lookback.
+func WithUndoDepth(depth int) Option {
+	return func(tr *Translator) {
+		tr.undoDepth = depth
 	}
 }
 
-func newSuffix(raw, suffix string, outline stroke.Outline, prev *Translation) *Translation {
-	return &Translation{
-		result:   Result{raw, suffix + " ", " "},
-		outline:  outline,
-		prev:     prev,
-		replaced: nil,
+// SpaceMode selects which side of each translation its separating space
+// goes on.
+type SpaceMode int
+
+const (
+	// SpaceAfter types "word ", so attaching text backspaces first.
+	SpaceAfter SpaceMode = iota
+	// SpaceBefore types " word", like Plover's space before mode.
+	SpaceBefore
+)
+
+// ParseSpaceMode maps the config names "after" and "before" to a SpaceMode.
+func ParseSpaceMode(name string) (SpaceMode, error) {
+	switch name {
+	case "after":
+		return SpaceAfter, nil
+	case "before":
+		return SpaceBefore, nil
+	default:
+		return 0, fmt.Errorf("unknown space mode %q", name)
 	}
 }
 
-func newUntranslatable(outline stroke.Outline, prev *Translation) *Translation {
-	return &Translation{
-		result:   Result{outline.String(), outline.String() + " ", ""},
-		outline:  outline,
-		prev:     prev,
-		replaced: nil,
+// WithSpaceMode sets where the space between translations goes.
+func WithSpaceMode(mode SpaceMode) Option {
+	return func(tr *Translator) {
+		tr.spaceMode = mode
 	}
 }
 
-func newUndo(raw string, outline stroke.Outline, prev *Translation) *Translation {
+// spaced builds the result of typing text for raw, with the separating space
+// on the side the space mode asks for. Attached text joins what came before.
+func (tr *Translator) spaced(raw, text string, attach bool) Result {
+	switch {
+	case tr.spaceMode == SpaceBefore && attach:
+		return Result{raw, text, ""}
+	case tr.spaceMode == SpaceBefore:
+		return Result{raw, " " + text, ""}
+	case attach:
+		return Result{raw, text + " ", " "}
+	default:
+		return Result{raw, text + " ", ""}
+	}
+}
+
+func (tr *Translator) newWord(raw string, outline stroke.Outline) *Translation {
 	return &Translation{
-		result:   Result{raw, prev.result.replaced, prev.result.text},
-		outline:  outline,
-		prev:     nil,
-		replaced: nil,
+		result:  tr.spaced(raw, raw, false),
+		outline: outline,
 	}
 }
 
-func newBlank() *Translation {
+func (tr *Translator) newSuffix(raw, suffix string, outline stroke.Outline) *Translation {
 	return &Translation{
-		result:   Result{"", "", ""},
-		outline:  stroke.Outline{},
-		prev:     nil,
-		replaced: nil,
+		result:  tr.spaced(raw, suffix, true),
+		outline: outline,
 	}
 }
 
+func newUndo(raw string, outline stroke.Outline, latest *Translation) *Translation {
+	t := &Translation{
+		result:  Result{raw, "", ""},
+		outline: outline,
+	}
+	if latest != nil {
+		t.typed = output.NewOutput(latest.typed.Undo, latest.typed.Write)
+	}
+	return t
+}
+
 // NewTranslator creates a new Translator instance.
-func NewTranslator(dict dictionary.Dict, outlineCap int, in chan stroke.Stroke) *Translator {
+func NewTranslator(dict dictionary.Dict, outlineCap int, in chan stroke.Capture, opts ...Option) *Translator {
 	t := &Translator{
-		dict: dict,
-		latest: &Translation{
-			result:   Result{"", "", ""},
-			outline:  stroke.Outline{},
-			prev:     nil,
-			replaced: nil,
-		},
+		dict:       dict,
+		undoDepth:  DefaultUndoDepth,
 		outlineCap: outlineCap,
 		in:         in,
 		out:        make(chan output.Output, 16),
+		events:     make(chan Event, 16),
+		tail:       tail{size: DefaultTailSize},
+
+		untranslateMarker: DefaultUntranslateMarker,
 	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.history = newHistory(max(t.undoDepth, t.outlineCap))
 	return t
 }
 
-// provides the longest possible match
-func (tr *Translator) translate(outline stroke.Outline, prev *Translation, replacing string) *Translation {
+// SetDictionary replaces the dictionary strokes are looked up in. The
+// history is kept, growing if the new dictionary has longer outlines, so
+// undo and multi-stroke entries carry on across the swap.
+func (tr *Translator) SetDictionary(dict dictionary.Dict, outlineCap int) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.dict = dict
+	tr.outlineCap = outlineCap
+	if depth := max(tr.undoDepth, outlineCap); depth > len(tr.history.entries) {
+		h := newHistory(depth)
+		for _, t := range tr.history.last(tr.history.size) {
+			h.push(t)
+		}
+		tr.history = h
+	}
+}
 
-	if len(outline) > tr.outlineCap {
-		return nil // too deep to match
+// provides the longest possible match
+func (tr *Translator) translate(s stroke.Stroke) *Translation {
+	// Count how many previous translations fit in front of the new stroke
+	// without the outline growing past outlineCap.
+	lookback, strokes := 0, 1
+	for t := tr.history.peek(0); t != nil; t = tr.history.peek(lookback) {
+		if strokes+len(t.outline) > tr.outlineCap {
+			break
+		}
+		strokes += len(t.outline)
+		lookback++
 	}
 
-	if prev.prev != nil {
-		translation := tr.translate(append(prev.outline, outline...), prev.prev, prev.result.text+replacing)
-		if translation != nil {
-			return translation // return the longest possible translation
+	// Try the longest candidate first, dropping one translation at a time,
+	// in the layer held with the stroke before the main dictionary.
+	for _, dict := range [...]dictionary.Dict{tr.layer, tr.dict} {
+		if dict == nil {
+			continue
+		}
+		for n := lookback; n >= 0; n-- {
+			if entry, ok := tr.lookup(dict, n, s); ok {
+				candidate := tr.candidate(n, s)
+				t := tr.newTranslation(entry, candidate, tr.history.peek(n))
+				t.time = tr.now
+				if entry == "=undo" || isCommand(entry) {
+					return t
+				}
+				return tr.settle(t, n)
+			}
 		}
 	}
 
-	if entry, ok := tr.dict.Lookup(outline); ok {
-		return tr.newTranslation(entry, replacing, outline, prev)
+	t := tr.newUntranslatable(s.Outline())
+	if digits, ok := s.Digits(); ok {
+		t = tr.newGlue(s.String(), digits, s.Outline(), tr.history.peek(0))
 	}
+	t.time = tr.now
+	return tr.settle(t, 0)
+}
 
-	if len(outline) == 1 {
-		return newUntranslatable(outline, prev)
+// lookup finds the entry in dict for the n latest translations followed by
+// s. A dictionary that is a trie is walked from the oldest stroke, stopping
+// as soon as no outline starts with the strokes so far.
+func (tr *Translator) lookup(dict dictionary.Dict, n int, s stroke.Stroke) (string, bool) {
+	p, ok := dict.(dictionary.Prefixer)
+	if !ok {
+		return dict.Lookup(tr.candidate(n, s))
 	}
+	node := p.Root()
+	for ; n > 0 && node != nil; n-- {
+		node = node.Walk(tr.history.peek(n - 1).outline)
+	}
+	return node.Child(s).Entry()
+}
 
-	return nil // unreachable
+// candidate is the outline of the n latest translations followed by s.
+func (tr *Translator) candidate(n int, s stroke.Stroke) stroke.Outline {
+	var outline stroke.Outline
+	for ; n > 0; n-- {
+		outline = append(outline, tr.history.peek(n-1).outline...)
+	}
+	return append(outline, s)
+}
+
+// settle works out what typing t takes now that it replaces the n latest
+// translations, and updates the translations left just before it.
+func (tr *Translator) settle(t *Translation, n int) *Translation {
+	consumed := tr.history.last(n)
+	visible, restore := onScreen(consumed)
+	t.replaced = consumed
+	t.typed = compose(output.NewOutput(restore, visible), t.result.write())
+
+	t = tr.resolve(t, tr.history.peek(n), visible, restore)
+	return tr.flush(t, n, visible)
+}
+
+// onScreen returns the text that ts left on screen, and the text before them
+// that they trimmed away.
+func onScreen(ts []*Translation) (visible, restore string) {
+	var screen, trimmed []rune
+	for _, t := range ts {
+		trim := []rune(t.result.trim)
+		if len(trim) > len(screen) {
+			trimmed = append(trim[:len(trim)-len(screen)], trimmed...)
+			screen = screen[:0]
+		} else {
+			screen = screen[:len(screen)-len(trim)]
+		}
+		screen = append(screen, []rune(t.result.text)...)
+	}
+	return string(screen), string(trimmed)
 }
 
 func (tr *Translator) updateHistory(latest *Translation) {
 	if latest.result.raw == "=undo" {
-		tr.undo()
-	} else {
-		tr.latest = latest
+		if tr.undoMode == UndoStroke {
+			tr.undoStroke(latest)
+		} else {
+			tr.undo()
+		}
+		return
 	}
+	if isCommand(latest.result.raw) {
+		tr.runCommand(latest)
+		return
+	}
+	for range latest.replaced {
+		tr.history.pop()
+	}
+	tr.history.push(latest)
 }
 
 func (tr *Translator) undo() {
-	if tr.latest.replaced != nil {
-		tr.latest = tr.latest.replaced
-	} else if tr.latest.prev != nil {
-		tr.latest = tr.latest.prev
+	latest := tr.history.pop()
+	if latest == nil {
+		return
+	}
+	for _, t := range latest.replaced {
+		tr.history.push(t)
+	}
+}
+
+// undoStroke takes the latest translation off the history and translates all
+// but its last stroke again, rewriting u to type the difference.
+func (tr *Translator) undoStroke(u *Translation) {
+	latest := tr.history.pop()
+	if latest == nil {
+		return
+	}
+	// Translations that latest consumed are no longer on screen, so only its
+	// own text is taken back before the remaining strokes are typed again.
+	out := latest.result.revert()
+	for _, s := range latest.outline[:len(latest.outline)-1] {
+		t := tr.translate(s)
+		tr.updateHistory(t)
+		out = compose(out, t.write())
+	}
+	u.typed = out
+}
+
+// compose returns one output with the same effect as typing a and then b.
+func compose(a, b output.Output) output.Output {
+	written := []rune(a.Write)
+	undo := []rune(b.Undo)
+	if len(undo) <= len(written) {
+		return output.NewOutput(string(written[:len(written)-len(undo)])+b.Write, a.Undo)
 	}
+	return output.NewOutput(b.Write, string(undo[:len(undo)-len(written)])+a.Undo)
 }
 
 func (tr *Translator) Out() chan output.Output {
 	return tr.out
 }
 
+// step translates a single stroke and returns what should be typed.
+func (tr *Translator) step(c stroke.Capture) output.Output {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.now = c.Time
+	tr.layer = tr.layers[strings.Join(c.Extra, "+")]
+	latest := tr.translate(c.Stroke)
+	tr.layer = nil
+	tr.updateHistory(latest)
+	out := latest.write()
+	out.Time = c.Time
+	tr.tail.apply(out)
+	return out
+}
+
+// Run translates strokes until the input is closed, then types out any
+// untranslates still buffered and closes Out and Events.
 func (tr *Translator) Run() {
-	for stroke := range tr.in {
-		latest := tr.translate(stroke.Outline(), tr.latest, "")
-		tr.updateHistory(latest)
-		tr.out <- latest.result.write()
+	for c := range tr.in {
+		tr.out <- tr.step(c)
+	}
+	if out, ok := tr.finish(); ok {
+		tr.out <- out
 	}
 	close(tr.out)
+	close(tr.events)
+}
+
+// trimEnd drops the last n runes of text.
+func trimEnd(text string, n int) string {
+	runes := []rune(text)
+	if n > len(runes) {
+		n = len(runes)
+	}
+	return string(runes[:len(runes)-n])
 }
@@ -5,10 +5,16 @@
 package translator
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sten/dictionary"
 	"sten/output"
 	"sten/stroke"
 	"testing"
+	"time"
 )
 
 // MockDictionary is a basic stub for dictionary.Dictionary
@@ -16,18 +22,26 @@ type MockDictionary struct {
 	entries map[string]string
 }
 
-func (m *MockDictionary) Lookup(outline fmt.Stringer) (string, bool) {
+func (m *MockDictionary) Lookup(outline stroke.Outline) (string, bool) {
 	val, ok := m.entries[outline.String()]
 	return val, ok
 }
 
+// capture wraps steno in a stroke.Capture with no timing.
+func capture(steno string) stroke.Capture {
+	return stroke.Capture{Stroke: stroke.ParseSteno(steno)}
+}
+
 func TestTranslator(t *testing.T) {
 	type testCase struct {
 		name       string
 		dict       map[string]string
 		outlineCap int
+		opts       []Option
 		strokes    []string
 		expected   []output.Output
+		// expected outputs with the space typed before each word
+		spaceBefore []output.Output
 	}
 
 	cases := []testCase{
@@ -46,10 +60,16 @@ func TestTranslator(t *testing.T) {
 			},
 			outlineCap: 1,
 			expected: []output.Output{
-				{"hello ", ""},
-				{"hello ", ""},
-				{"", "hello "},
-				{"TPHOEPB ", ""},
+				{Write: "hello ", Undo: ""},
+				{Write: "hello ", Undo: ""},
+				{Write: "", Undo: "hello "},
+				{Write: "TPHOEPB ", Undo: ""},
+			},
+			spaceBefore: []output.Output{
+				{Write: " hello", Undo: ""},
+				{Write: " hello", Undo: ""},
+				{Write: "", Undo: " hello"},
+				{Write: " TPHOEPB", Undo: ""},
 			},
 		},
 		{
@@ -75,14 +95,24 @@ func TestTranslator(t *testing.T) {
 			},
 			outlineCap: 4,
 			expected: []output.Output{
-				{"you ", ""},
-				{"are ", ""},
-				{"in ", ""},
-				{"the ", ""},
-				{"HREB ", ""},
-				{"intellectual ", "in the HREB "},
-				{"in the HREB ", "intellectual "},
-				{"intellectual ", "in the HREB "},
+				{Write: "you ", Undo: ""},
+				{Write: "are ", Undo: ""},
+				{Write: "in ", Undo: ""},
+				{Write: "the ", Undo: ""},
+				{Write: "HREB ", Undo: ""},
+				{Write: "intellectual ", Undo: "in the HREB "},
+				{Write: "in the HREB ", Undo: "intellectual "},
+				{Write: "intellectual ", Undo: "in the HREB "},
+			},
+			spaceBefore: []output.Output{
+				{Write: " you", Undo: ""},
+				{Write: " are", Undo: ""},
+				{Write: " in", Undo: ""},
+				{Write: " the", Undo: ""},
+				{Write: " HREB", Undo: ""},
+				{Write: " intellectual", Undo: " in the HREB"},
+				{Write: " in the HREB", Undo: " intellectual"},
+				{Write: " intellectual", Undo: " in the HREB"},
 			},
 		},
 		{
@@ -98,17 +128,113 @@ func TestTranslator(t *testing.T) {
 				"PWER",
 				"-PLT",
 				"*",
+				"-PLT",
+				"*",
+				"*",
+				"PWER",
+				"*",
 				"*",
 				"*",
 			},
 			outlineCap: 3,
 			expected: []output.Output{
-				{"dismember ", ""},
-				{"dismember ", "dismember "},
-				{"dismemberment ", "dismember "},
-				{"dismember ", "dismemberment "}, // Should not rewrite dismember twice
-				{"dismember ", "dismember "},
-				{"", "dismember "},
+				{Write: "dismember ", Undo: ""},
+				{Write: "dismember ", Undo: "dismember "},
+				{Write: "dismemberment ", Undo: "dismember "},
+				{Write: "dismember ", Undo: "dismemberment "}, // Should not rewrite dismember twice
+				{Write: "dismemberment ", Undo: "dismember "},
+				{Write: "dismember ", Undo: "dismemberment "},
+				{Write: "dismember ", Undo: "dismember "},
+				{Write: "dismember ", Undo: "dismember "},
+				{Write: "dismember ", Undo: "dismember "},
+				{Write: "", Undo: "dismember "},
+				{Write: "", Undo: ""},
+			},
+			spaceBefore: []output.Output{
+				{Write: " dismember", Undo: ""},
+				{Write: " dismember", Undo: " dismember"},
+				{Write: " dismemberment", Undo: " dismember"},
+				{Write: " dismember", Undo: " dismemberment"},
+				{Write: " dismemberment", Undo: " dismember"},
+				{Write: " dismember", Undo: " dismemberment"},
+				{Write: " dismember", Undo: " dismember"},
+				{Write: " dismember", Undo: " dismember"},
+				{Write: " dismember", Undo: " dismember"},
+				{Write: "", Undo: " dismember"},
+				{Write: "", Undo: ""},
+			},
+		},
+		{
+			// Stroke undo types the strokes left of pear again, and apple
+			// picks "an" once more.
+			name: "Undo Multi-Stroke",
+			dict: map[string]string{
+				"AEU":   "{=[AEIOUaeiou]/an/a}",
+				"AP":    "apple",
+				"AP/-L": "pear",
+				"*":     "=undo",
+			},
+			strokes: []string{
+				"AEU",
+				"AP",
+				"-L",
+				"*",
+				"*",
+				"*",
+			},
+			outlineCap: 2,
+			expected: []output.Output{
+				{Write: "a ", Undo: ""},
+				{Write: "an apple ", Undo: "a "},
+				{Write: "a pear ", Undo: "an apple "},
+				{Write: "an apple ", Undo: "a pear "},
+				{Write: "", Undo: "apple "},
+				{Write: "", Undo: "an "},
+			},
+			spaceBefore: []output.Output{
+				{Write: " a", Undo: ""},
+				{Write: " an apple", Undo: " a"},
+				{Write: " a pear", Undo: " an apple"},
+				{Write: " an apple", Undo: " a pear"},
+				{Write: "", Undo: " apple"},
+				{Write: "", Undo: " an"},
+			},
+		},
+		{
+			// Translation undo puts apple back as it was, and like any undo
+			// leaves the a/an choice to the next translation.
+			name: "Undo Multi-Stroke (translation undo)",
+			dict: map[string]string{
+				"AEU":   "{=[AEIOUaeiou]/an/a}",
+				"AP":    "apple",
+				"AP/-L": "pear",
+				"*":     "=undo",
+			},
+			strokes: []string{
+				"AEU",
+				"AP",
+				"-L",
+				"*",
+				"*",
+				"*",
+			},
+			outlineCap: 2,
+			opts:       []Option{WithUndoMode(UndoTranslation)},
+			expected: []output.Output{
+				{Write: "a ", Undo: ""},
+				{Write: "an apple ", Undo: "a "},
+				{Write: "a pear ", Undo: "an apple "},
+				{Write: "apple ", Undo: "pear "},
+				{Write: "", Undo: "apple "},
+				{Write: "", Undo: "a "},
+			},
+			spaceBefore: []output.Output{
+				{Write: " a", Undo: ""},
+				{Write: " an apple", Undo: " a"},
+				{Write: " a pear", Undo: " an apple"},
+				{Write: " apple", Undo: " pear"},
+				{Write: "", Undo: " apple"},
+				{Write: "", Undo: " a"},
 			},
 		},
 		{
@@ -133,13 +259,22 @@ func TestTranslator(t *testing.T) {
 			},
 			outlineCap: 5,
 			expected: []output.Output{
-				{"you ", ""},
-				{"are ", ""},
-				{"in ", ""},
-				{"you're into ", "you are in "},
-				{"HREB ", ""},
-				{"TWAL ", ""},
-				{"E ", ""},
+				{Write: "you ", Undo: ""},
+				{Write: "are ", Undo: ""},
+				{Write: "in ", Undo: ""},
+				{Write: "you're into ", Undo: "you are in "},
+				{Write: "HREB ", Undo: ""},
+				{Write: "TWAL ", Undo: ""},
+				{Write: "E ", Undo: ""},
+			},
+			spaceBefore: []output.Output{
+				{Write: " you", Undo: ""},
+				{Write: " are", Undo: ""},
+				{Write: " in", Undo: ""},
+				{Write: " you're into", Undo: " you are in"},
+				{Write: " HREB", Undo: ""},
+				{Write: " TWAL", Undo: ""},
+				{Write: " E", Undo: ""},
 			},
 		},
 		{
@@ -160,40 +295,695 @@ func TestTranslator(t *testing.T) {
 			},
 			outlineCap: 2,
 			expected: []output.Output{
-				{"come ", ""},
-				{"complete ", "come "},
-				{".py ", " "},
-				{" ", ".py "},
-				{"come ", "complete "},
-				{"", "come "},
+				{Write: "come ", Undo: ""},
+				{Write: "complete ", Undo: "come "},
+				{Write: ".py ", Undo: " "},
+				{Write: " ", Undo: ".py "},
+				{Write: "come ", Undo: "complete "},
+				{Write: "", Undo: "come "},
+			},
+			spaceBefore: []output.Output{
+				{Write: " come", Undo: ""},
+				{Write: " complete", Undo: " come"},
+				{Write: ".py", Undo: ""},
+				{Write: "", Undo: ".py"},
+				{Write: " come", Undo: " complete"},
+				{Write: "", Undo: " come"},
+			},
+		},
+		{
+			name: "Conditionals",
+			dict: map[string]string{
+				"AEU":  "{=[AEIOUaeiou]/an/a}",
+				"AP":   "apple",
+				"PAER": "pear",
+				"*":    "=undo",
+			},
+			strokes: []string{
+				"AEU",
+				"AP",
+				"AEU",
+				"PAER",
+				"*",
+				"AP",
+				"*",
+				"PAER",
+				"*",
+				"*",
+			},
+			outlineCap: 1,
+			expected: []output.Output{
+				{Write: "a ", Undo: ""},
+				{Write: "an apple ", Undo: "a "},
+				{Write: "a ", Undo: ""},
+				{Write: "pear ", Undo: ""},
+				{Write: "", Undo: "pear "},
+				{Write: "an apple ", Undo: "a "},
+				{Write: "", Undo: "apple "},
+				{Write: "a pear ", Undo: "an "},
+				{Write: "", Undo: "pear "},
+				{Write: "", Undo: "a "},
+			},
+			spaceBefore: []output.Output{
+				{Write: " a", Undo: ""},
+				{Write: " an apple", Undo: " a"},
+				{Write: " a", Undo: ""},
+				{Write: " pear", Undo: ""},
+				{Write: "", Undo: " pear"},
+				{Write: " an apple", Undo: " a"},
+				{Write: "", Undo: " apple"},
+				{Write: " a pear", Undo: " an"},
+				{Write: "", Undo: " pear"},
+				{Write: "", Undo: " a"},
+			},
+		},
+		{
+			name: "Conditionals (translation undo)",
+			dict: map[string]string{
+				"AEU": "{=[AEIOUaeiou]/an/a}",
+				"AP":  "apple",
+				"*":   "=undo",
+			},
+			strokes: []string{
+				"AEU",
+				"AP",
+				"*",
+				"*",
+			},
+			outlineCap: 1,
+			opts:       []Option{WithUndoMode(UndoTranslation)},
+			expected: []output.Output{
+				{Write: "a ", Undo: ""},
+				{Write: "an apple ", Undo: "a "},
+				{Write: "", Undo: "apple "},
+				{Write: "", Undo: "an "}, // the re-picked text, not "a "
+			},
+			spaceBefore: []output.Output{
+				{Write: " a", Undo: ""},
+				{Write: " an apple", Undo: " a"},
+				{Write: "", Undo: " apple"},
+				{Write: "", Undo: " an"},
+			},
+		},
+		{
+			name: "Undo Depth",
+			dict: map[string]string{
+				"U":    "you",
+				"R":    "are",
+				"EUPB": "in",
+				"*":    "=undo",
+			},
+			strokes: []string{
+				"U",
+				"R",
+				"EUPB",
+				"*",
+				"*",
+				"*",
+			},
+			outlineCap: 1,
+			opts:       []Option{WithUndoDepth(2)},
+			expected: []output.Output{
+				{Write: "you ", Undo: ""},
+				{Write: "are ", Undo: ""},
+				{Write: "in ", Undo: ""},
+				{Write: "", Undo: "in "},
+				{Write: "", Undo: "are "},
+				{Write: "", Undo: ""}, // "you" fell out of the history
+			},
+			spaceBefore: []output.Output{
+				{Write: " you", Undo: ""},
+				{Write: " are", Undo: ""},
+				{Write: " in", Undo: ""},
+				{Write: "", Undo: " in"},
+				{Write: "", Undo: " are"},
+				{Write: "", Undo: ""},
+			},
+		},
+		{
+			name: "Untranslate Marker",
+			dict: map[string]string{
+				"U": "you",
+				"*": "=undo",
+			},
+			strokes: []string{
+				"U",
+				"TPHOEPB",
+				"*",
+			},
+			outlineCap: 1,
+			opts:       []Option{WithUntranslateMode(UntranslateMarker), WithUntranslateMarker("?")},
+			expected: []output.Output{
+				{Write: "you ", Undo: ""},
+				{Write: "? ", Undo: ""},
+				{Write: "", Undo: "? "},
+			},
+			spaceBefore: []output.Output{
+				{Write: " you", Undo: ""},
+				{Write: " ?", Undo: ""},
+				{Write: "", Undo: " ?"},
+			},
+		},
+		{
+			name: "Untranslate None",
+			dict: map[string]string{
+				"U": "you",
+			},
+			strokes: []string{
+				"TPHOEPB",
+				"U",
+			},
+			outlineCap: 1,
+			opts:       []Option{WithUntranslateMode(UntranslateNone)},
+			expected: []output.Output{
+				{Write: "", Undo: ""},
+				{Write: "you ", Undo: ""},
+			},
+			spaceBefore: []output.Output{
+				{Write: "", Undo: ""},
+				{Write: " you", Undo: ""},
+			},
+		},
+		{
+			name: "Untranslate Buffer",
+			dict: map[string]string{
+				"A/PWO": "about",
+				"U":     "you",
+			},
+			strokes: []string{
+				"A",
+				"PWO",
+				"A",
+				"U",
+				"A",
+				"TPH",
+				"U",
+			},
+			outlineCap: 2,
+			opts:       []Option{WithUntranslateMode(UntranslateBuffer)},
+			expected: []output.Output{
+				{Write: "", Undo: ""},
+				{Write: "about ", Undo: ""},
+				{Write: "", Undo: ""},
+				{Write: "A you ", Undo: ""},
+				{Write: "", Undo: ""},
+				{Write: "", Undo: ""},
+				{Write: "A TPH you ", Undo: ""},
+			},
+			spaceBefore: []output.Output{
+				{Write: "", Undo: ""},
+				{Write: " about", Undo: ""},
+				{Write: "", Undo: ""},
+				{Write: " A you", Undo: ""},
+				{Write: "", Undo: ""},
+				{Write: "", Undo: ""},
+				{Write: " A TPH you", Undo: ""},
 			},
 		},
+		{
+			name: "Untranslate Buffer Undo",
+			dict: map[string]string{
+				"U": "you",
+				"*": "=undo",
+			},
+			strokes: []string{
+				"TPH",
+				"U",
+				"*",
+				"*",
+			},
+			outlineCap: 1,
+			opts:       []Option{WithUntranslateMode(UntranslateBuffer)},
+			expected: []output.Output{
+				{Write: "", Undo: ""},
+				{Write: "TPH you ", Undo: ""},
+				{Write: "", Undo: "you "},
+				{Write: "", Undo: "TPH "},
+			},
+			spaceBefore: []output.Output{
+				{Write: "", Undo: ""},
+				{Write: " TPH you", Undo: ""},
+				{Write: "", Undo: " you"},
+				{Write: "", Undo: " TPH"},
+			},
+		},
+		{
+			name: "Untranslate Buffer Undo (translation undo)",
+			dict: map[string]string{
+				"U": "you",
+				"*": "=undo",
+			},
+			strokes: []string{
+				"TPH",
+				"U",
+				"*",
+				"*",
+			},
+			outlineCap: 1,
+			opts:       []Option{WithUntranslateMode(UntranslateBuffer), WithUndoMode(UndoTranslation)},
+			expected: []output.Output{
+				{Write: "", Undo: ""},
+				{Write: "TPH you ", Undo: ""},
+				{Write: "", Undo: "you "},
+				{Write: "", Undo: "TPH "},
+			},
+			spaceBefore: []output.Output{
+				{Write: "", Undo: ""},
+				{Write: " TPH you", Undo: ""},
+				{Write: "", Undo: " you"},
+				{Write: "", Undo: " TPH"},
+			},
+		},
+		{
+			name: "Untranslate Buffer End",
+			dict: map[string]string{
+				"U": "you",
+			},
+			strokes: []string{
+				"TPH",
+				"U",
+				"A",
+				"PWO",
+			},
+			outlineCap: 1,
+			opts:       []Option{WithUntranslateMode(UntranslateBuffer)},
+			expected: []output.Output{
+				{Write: "", Undo: ""},
+				{Write: "TPH you ", Undo: ""},
+				{Write: "", Undo: ""},
+				{Write: "", Undo: ""},
+				{Write: "A PWO ", Undo: ""},
+			},
+			spaceBefore: []output.Output{
+				{Write: "", Undo: ""},
+				{Write: " TPH you", Undo: ""},
+				{Write: "", Undo: ""},
+				{Write: "", Undo: ""},
+				{Write: " A PWO", Undo: ""},
+			},
+		},
+		{
+			name: "Glue",
+			dict: map[string]string{
+				"A*":      "{&a}",
+				"PW*":     "{&b}",
+				"KAT":     "cat",
+				"PW*/KAT": "bobcat",
+				"*":       "=undo",
+			},
+			strokes: []string{
+				"A*",
+				"PW*",
+				"KAT",
+				"*",
+				"#SA", // number strokes glue as digits
+				"*",
+				"*",
+				"*",
+			},
+			outlineCap: 2,
+			expected: []output.Output{
+				{Write: "a ", Undo: ""},
+				{Write: "b ", Undo: " "},
+				{Write: " bobcat ", Undo: "b "},
+				{Write: "b ", Undo: " bobcat "},
+				{Write: "15 ", Undo: " "},
+				{Write: " ", Undo: "15 "},
+				{Write: " ", Undo: "b "},
+				{Write: "", Undo: "a "},
+			},
+			spaceBefore: []output.Output{
+				{Write: " a", Undo: ""},
+				{Write: "b", Undo: ""},
+				{Write: " bobcat", Undo: "b"},
+				{Write: "b", Undo: " bobcat"},
+				{Write: "15", Undo: ""},
+				{Write: "", Undo: "15"},
+				{Write: "", Undo: "b"},
+				{Write: "", Undo: " a"},
+			},
+		},
+	}
+
+	modes := []struct {
+		name     string
+		mode     SpaceMode
+		expected func(testCase) []output.Output
+	}{
+		{"SpaceAfter", SpaceAfter, func(tc testCase) []output.Output { return tc.expected }},
+		{"SpaceBefore", SpaceBefore, func(tc testCase) []output.Output { return tc.spaceBefore }},
+	}
+
+	// Each case runs against a plain lookup and against a trie, which the
+	// translator walks instead.
+	dicts := []struct {
+		name string
+		load func(*testing.T, map[string]string) dictionary.Dict
+	}{
+		{"Lookup", func(_ *testing.T, entries map[string]string) dictionary.Dict { return &MockDictionary{entries} }},
+		{"Trie", loadTrie},
 	}
 
 	for _, tc := range cases {
-		t.Run(tc.name, func(t *testing.T) {
-			in := make(chan stroke.Stroke, len(tc.strokes))
-			tr := NewTranslator(&MockDictionary{tc.dict}, tc.outlineCap, in)
-			go tr.Run()
-			for _, steno := range tc.strokes {
-				in <- stroke.ParseSteno(steno)
-			}
-			close(in)
-			i := 0
-			fmt.Println("testing output")
-			for out := range tr.Out() {
-				fmt.Println(out)
-				if i >= len(tc.expected) {
-					t.Fatalf("got more outputs than expected: %+v", out)
-				}
-				if out != tc.expected[i] {
-					t.Errorf("at %d: expected %+v, got %+v", i, tc.expected[i], out)
-				}
-				i++
+		for _, m := range modes {
+			for _, d := range dicts {
+				t.Run(tc.name+"/"+m.name+"/"+d.name, func(t *testing.T) {
+					expected := m.expected(tc)
+					in := make(chan stroke.Capture, len(tc.strokes))
+					opts := append([]Option{WithSpaceMode(m.mode)}, tc.opts...)
+					tr := NewTranslator(d.load(t, tc.dict), tc.outlineCap, in, opts...)
+					go tr.Run()
+					for _, steno := range tc.strokes {
+						in <- capture(steno)
+					}
+					close(in)
+					i := 0
+					fmt.Println("testing output")
+					for out := range tr.Out() {
+						fmt.Println(out)
+						if i >= len(expected) {
+							t.Fatalf("got more outputs than expected: %+v", out)
+						}
+						if out != expected[i] {
+							t.Errorf("at %d: expected %+v, got %+v", i, expected[i], out)
+						}
+						i++
+					}
+					if i != len(expected) {
+						t.Fatalf("expected %d outputs, got %d", len(expected), i)
+					}
+				})
 			}
-			if i != len(tc.expected) {
-				t.Fatalf("expected %d outputs, got %d", len(tc.expected), i)
+		}
+	}
+}
+
+// loadTrie loads entries as a dictionary file would be.
+func loadTrie(t *testing.T, entries map[string]string) dictionary.Dict {
+	t.Helper()
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatalf("failed to encode dictionary: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "test.json"), data, 0644); err != nil {
+		t.Fatalf("failed to write dictionary: %v", err)
+	}
+	dict, _, err := dictionary.LoadDictionaries(dir)
+	if err != nil {
+		t.Fatalf("failed to load dictionary: %v", err)
+	}
+	return dict
+}
+
+func TestUntranslateEvents(t *testing.T) {
+	dict := &MockDictionary{map[string]string{"U": "you"}}
+	tr := NewTranslator(dict, 1, nil)
+	tr.step(capture("U"))
+	tr.step(capture("TPHOEPB"))
+
+	select {
+	case e := <-tr.Events():
+		if e.Kind != EventUntranslate || e.Text != "TPHOEPB " {
+			t.Errorf("unexpected event %+v", e)
+		}
+	default:
+		t.Fatalf("expected an untranslate event")
+	}
+}
+
+// MockSearcher answers every search with the text it was asked about.
+type MockSearcher struct {
+	MockDictionary
+}
+
+func (m *MockSearcher) Search(text string, mode dictionary.SearchMode, limit int) []dictionary.Match {
+	return []dictionary.Match{{Translation: text, Outlines: []stroke.Outline{stroke.ParseOutline("WORLD")}}}
+}
+
+func (m *MockSearcher) SearchOutline(prefix stroke.Outline, limit int) []dictionary.Match {
+	return nil
+}
+
+func TestLookupEvent(t *testing.T) {
+	dict := &MockSearcher{MockDictionary{map[string]string{
+		"WORLD": "world",
+		"PHRUP": "{PLOVER:LOOKUP}",
+		"*":     "=undo",
+	}}}
+	tr := NewTranslator(dict, 1, nil)
+	tr.step(capture("WORLD"))
+	if out := tr.step(capture("PHRUP")); out.Write != "" || out.Undo != "" {
+		t.Errorf("expected lookup to type nothing, got %+v", out)
+	}
+
+	select {
+	case e := <-tr.Events():
+		if e.Kind != EventLookup || e.Text != "world" || len(e.Matches) != 1 || e.Matches[0].Translation != "world" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	default:
+		t.Fatalf("expected a lookup event")
+	}
+
+	// The lookup is not in the history, so undo takes back the word.
+	if out := tr.step(capture("*")); out.Undo != "world " {
+		t.Errorf("expected undo of %q, got %+v", "world ", out)
+	}
+}
+
+func TestCaptureTime(t *testing.T) {
+	dict := &MockDictionary{map[string]string{"U": "you"}}
+	tr := NewTranslator(dict, 1, nil)
+	at := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	out := tr.step(stroke.Capture{Stroke: stroke.ParseSteno("U"), Time: at})
+	if !out.Time.Equal(at) {
+		t.Errorf("expected output time %v, got %v", at, out.Time)
+	}
+	tr.step(stroke.Capture{Stroke: stroke.ParseSteno("TPHOEPB"), Time: at.Add(time.Second)})
+	if e := <-tr.Events(); !e.Time.Equal(at.Add(time.Second)) {
+		t.Errorf("expected event time %v, got %v", at.Add(time.Second), e.Time)
+	}
+}
+
+func TestTail(t *testing.T) {
+	dict := &MockDictionary{map[string]string{
+		"U":            "you",
+		"KOPL":         "come",
+		"KOPL/PHRAOET": "complete",
+		"#P*EU":        "{^}.py",
+		"*":            "=undo",
+	}}
+	tr := NewTranslator(dict, 2, nil, WithTailSize(16))
+	for _, steno := range []string{"U", "KOPL", "PHRAOET", "#P*EU"} {
+		tr.step(capture(steno))
+	}
+	if got := tr.Tail(5); got != "e.py " {
+		t.Errorf("expected tail %q, got %q", "e.py ", got)
+	}
+	if got := fmt.Sprint(tr.Words(5)); got != "[you complete.py]" {
+		t.Errorf("expected words [you complete.py], got %s", got)
+	}
+
+	for _, steno := range []string{"*", "U", "U", "U"} {
+		tr.step(capture(steno))
+	}
+	// Only the last 16 characters are kept.
+	if got := tr.Tail(100); got != "ete you you you " {
+		t.Errorf("expected tail %q, got %q", "ete you you you ", got)
+	}
+	if got := fmt.Sprint(tr.WordBoundaries(100)); got != "[0 4 8 12]" {
+		t.Errorf("expected boundaries [0 4 8 12], got %s", got)
+	}
+	if got, words := tr.Tail(-1), tr.Words(-1); got != "" || len(words) != 0 {
+		t.Errorf("expected nothing for negative counts, got %q and %q", got, words)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	dict := &MockDictionary{map[string]string{
+		"STKPHEPL":           "dismember",
+		"STKPHEPL/PWER":      "dismember",
+		"STKPHEPL/PWER/-PLT": "dismemberment",
+		"A*":                 "{&a}",
+		"*":                  "=undo",
+	}}
+	before := NewTranslator(dict, 3, nil)
+	for _, steno := range []string{"A*", "STKPHEPL", "PWER"} {
+		before.step(capture(steno))
+	}
+
+	data, err := json.Marshal(before.Snapshot())
+	if err != nil {
+		t.Fatalf("failed to encode snapshot: %v", err)
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatalf("failed to decode snapshot: %v", err)
+	}
+	after := NewTranslator(dict, 3, nil)
+	after.Restore(snap)
+
+	for _, steno := range []string{"-PLT", "*", "*", "*", "A*"} {
+		want := before.step(capture(steno))
+		got := after.step(capture(steno))
+		if got != want {
+			t.Errorf("after %s: expected %+v, got %+v", steno, want, got)
+		}
+	}
+	if before.Tail(100) != after.Tail(100) {
+		t.Errorf("expected tail %q, got %q", before.Tail(100), after.Tail(100))
+	}
+}
+
+func TestSetDictionary(t *testing.T) {
+	tr := NewTranslator(&MockDictionary{map[string]string{
+		"KOPL": "come",
+		"*":    "=undo",
+	}}, 1, nil, WithUndoDepth(1))
+	tr.step(capture("KOPL"))
+
+	// The new dictionary's longer outline finds the stroke made before the
+	// swap, and undo still knows what was typed.
+	tr.SetDictionary(&MockDictionary{map[string]string{
+		"KOPL":         "come",
+		"KOPL/PHRAOET": "complete",
+		"*":            "=undo",
+	}}, 2)
+	if got := tr.step(capture("PHRAOET")); got.Write != "complete " || got.Undo != "come " {
+		t.Errorf("expected to correct come to complete, got %+v", got)
+	}
+	if got := tr.step(capture("*")); got.Write != "come " || got.Undo != "complete " {
+		t.Errorf("expected undo back to come, got %+v", got)
+	}
+}
+
+func TestLayers(t *testing.T) {
+	tr := NewTranslator(&MockDictionary{map[string]string{
+		"TPH":     "in",
+		"TPH/TPH": "inn",
+		"S":       "is",
+	}}, 2, nil, WithLayers(Layers{
+		"Fn":      &MockDictionary{map[string]string{"TPH": "north", "S/S": "south"}},
+		"Fn+res1": &MockDictionary{map[string]string{"S": "east"}},
+	}))
+	held := func(steno string, keys ...string) stroke.Capture {
+		c := capture(steno)
+		c.Extra = keys
+		return c
+	}
+
+	cases := []struct {
+		c    stroke.Capture
+		want output.Output
+	}{
+		{capture("TPH"), output.Output{Write: "in "}},
+		// The layer comes first, even over a longer match in the main
+		// dictionary.
+		{held("TPH", "Fn"), output.Output{Write: "north "}},
+		// Strokes the layer has no entry for write as usual.
+		{held("S", "Fn"), output.Output{Write: "is "}},
+		{held("S", "Fn"), output.Output{Write: "south ", Undo: "is "}},
+		{held("S", "Fn", "res1"), output.Output{Write: "east "}},
+		{held("S", "res2"), output.Output{Write: "is "}},
+	}
+	for i, tc := range cases {
+		if got := tr.step(tc.c); got != tc.want {
+			t.Errorf("at %d: expected %+v, got %+v", i, tc.want, got)
+		}
+	}
+
+	tr.SetLayers(nil)
+	if got := tr.step(held("TPH", "Fn")); got.Write != "in " {
+		t.Errorf("expected no layer after SetLayers(nil), got %+v", got)
+	}
+}
+
+// BenchmarkHistoryMemory translates a million strokes and reports how much
+// the heap grew between the first hundred thousand and the end. With a
+// bounded history this should stay near zero.
+func BenchmarkHistoryMemory(b *testing.B) {
+	dict := &MockDictionary{map[string]string{
+		"U":           "you",
+		"R":           "are",
+		"EUPB":        "in",
+		"TE":          "the",
+		"U/R/EUPB/TE": "you're into",
+		"*":           "=undo",
+	}}
+	strokes := []stroke.Capture{
+		capture("U"),
+		capture("R"),
+		capture("EUPB"),
+		capture("TE"),
+		capture("*"),
+		capture("TPHOEPB"),
+	}
+	var early, late runtime.MemStats
+	for i := 0; i < b.N; i++ {
+		tr := NewTranslator(dict, 4, nil)
+		for j := 0; j < 1_000_000; j++ {
+			if j == 100_000 {
+				runtime.GC()
+				runtime.ReadMemStats(&early)
 			}
-		})
+			tr.step(strokes[j%len(strokes)])
+		}
+		runtime.GC()
+		runtime.ReadMemStats(&late)
+		runtime.KeepAlive(tr)
+		b.ReportMetric(float64(late.HeapInuse)-float64(early.HeapInuse), "heap-growth-B")
+	}
+}
+
+// stringDict looks outlines up by their steno string, the way dictionaries
+// were keyed before they were parsed at load time.
+type stringDict struct {
+	entries map[string]string
+}
+
+func (d stringDict) Lookup(outline stroke.Outline) (string, bool) {
+	result, ok := d.entries[outline.String()]
+	return result, ok
+}
+
+// lookupDict hides that a dictionary is a trie, so every candidate outline
+// is looked up from the root.
+type lookupDict struct {
+	dictionary.Dict
+}
+
+// BenchmarkTranslate compares walking the dictionary trie against looking up
+// each candidate outline in it, and against looking each up by its steno
+// string.
+func BenchmarkTranslate(b *testing.B) {
+	dict, outlineCap, err := dictionary.LoadDictionaries("../dictionaries")
+	if err != nil {
+		b.Fatalf("failed to load dictionaries: %v", err)
+	}
+	var strokes []stroke.Capture
+	for _, steno := range []string{"STKPHEPL", "PWER", "-PLT", "TH", "S", "AEU", "TEFT", "KWREU", "STKPWAO"} {
+		strokes = append(strokes, capture(steno))
+	}
+	run := func(b *testing.B, dict dictionary.Dict) {
+		tr := NewTranslator(dict, outlineCap, nil)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tr.step(strokes[i%len(strokes)])
+		}
+	}
+	entries := make(map[string]string)
+	for _, name := range []string{"lapwing-base.json", "lapwing-commands.json"} {
+		data, err := os.ReadFile(filepath.Join("../dictionaries", name))
+		if err != nil {
+			b.Fatalf("failed to read %s: %v", name, err)
+		}
+		if err := json.Unmarshal(data, &entries); err != nil {
+			b.Fatalf("failed to decode %s: %v", name, err)
+		}
 	}
+	b.Run("walk", func(b *testing.B) { run(b, dict) })
+	b.Run("lookup", func(b *testing.B) { run(b, lookupDict{dict}) })
+	b.Run("string", func(b *testing.B) { run(b, stringDict{entries}) })
 }
@@ -0,0 +1,136 @@
+// Copyright (c) 2025 Garrett Jennings.
+// This File is part of sten. Sten is free software under GPLv3 .
+// See LICENSE.txt for details.
+
+package translator
+
+import (
+	"fmt"
+	"sten/output"
+	"sten/stroke"
+	"strings"
+)
+
+// UntranslateMode selects what is typed for strokes with no dictionary entry.
+type UntranslateMode int
+
+const (
+	// UntranslateRaw types the steno itself.
+	UntranslateRaw UntranslateMode = iota
+	// UntranslateNone types nothing.
+	UntranslateNone
+	// UntranslateMarker types the untranslate marker instead of the steno.
+	UntranslateMarker
+	// UntranslateBuffer holds the strokes back until the next translation,
+	// so they can still join a longer outline, e.g. while fingerspelling.
+	// Strokes that don't are then typed as steno.
+	UntranslateBuffer
+)
+
+// DefaultUntranslateMarker is typed for untranslates in UntranslateMarker
+// mode unless WithUntranslateMarker says otherwise.
+const DefaultUntranslateMarker = "�"
+
+// ParseUntranslateMode maps the config names "raw", "none", "marker" and
+// "buffer" to an UntranslateMode.
+func ParseUntranslateMode(name string) (UntranslateMode, error) {
+	switch name {
+	case "raw":
+		return UntranslateRaw, nil
+	case "none":
+		return UntranslateNone, nil
+	case "marker":
+		return UntranslateMarker, nil
+	case "buffer":
+		return UntranslateBuffer, nil
+	default:
+		return 0, fmt.Errorf("unknown untranslate mode %q", name)
+	}
+}
+
+// WithUntranslateMode sets what is typed for strokes with no entry.
+func WithUntranslateMode(mode UntranslateMode) Option {
+	return func(tr *Translator) {
+		tr.untranslateMode = mode
+	}
+}
+
+// WithUntranslateMarker sets the text typed for untranslates in
+// UntranslateMarker mode.
+func WithUntranslateMarker(marker string) Option {
+	return func(tr *Translator) {
+		tr.untranslateMarker = marker
+	}
+}
+
+func (tr *Translator) newUntranslatable(outline stroke.Outline) *Translation {
+	t := &Translation{
+		result:  Result{outline.String(), "", ""},
+		outline: outline,
+	}
+	switch tr.untranslateMode {
+	case UntranslateRaw:
+		t.result = tr.spaced(outline.String(), outline.String(), false)
+	case UntranslateMarker:
+		t.result = tr.spaced(outline.String(), tr.untranslateMarker, false)
+	case UntranslateBuffer:
+		t.pending = true
+		return t
+	}
+	tr.emit(Event{Kind: EventUntranslate, Outline: outline, Text: t.result.text, Time: tr.now})
+	return t
+}
+
+// flush types out buffered untranslates that t follows without consuming.
+// Consecutive untranslates stay buffered so they can still combine.
+func (tr *Translator) flush(t *Translation, n int, visible string) *Translation {
+	if t.pending {
+		return t
+	}
+	text, ok := tr.typePending(n)
+	if !ok {
+		return t
+	}
+	// The translations t consumed come after the flushed ones on screen.
+	correction := compose(output.NewOutput(text+visible, visible), t.write())
+	t.correction = &correction
+	return t
+}
+
+// finish types out the untranslates still buffered once no stroke is left
+// to decide them.
+func (tr *Translator) finish() (output.Output, bool) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	text, ok := tr.typePending(0)
+	if !ok {
+		return output.Output{}, false
+	}
+	out := output.NewOutput(text, "")
+	out.Time = tr.now
+	tr.tail.apply(out)
+	return out, true
+}
+
+// typePending types the buffered untranslates from the nth latest
+// translation back, returning their text oldest first.
+func (tr *Translator) typePending(n int) (string, bool) {
+	var flushed []*Translation
+	for p := tr.history.peek(n); p != nil && p.pending; p = tr.history.peek(n) {
+		flushed = append(flushed, p)
+		n++
+	}
+	if len(flushed) == 0 {
+		return "", false
+	}
+	var text strings.Builder
+	for i := len(flushed) - 1; i >= 0; i-- {
+		p := flushed[i]
+		p.pending = false
+		p.result = tr.spaced(p.result.raw, p.result.raw, false)
+		p.typed = p.result.write()
+		text.WriteString(p.result.text)
+		tr.emit(Event{Kind: EventUntranslate, Outline: p.outline, Text: p.result.text, Time: p.time})
+	}
+	return text.String(), true
+}